@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/report"
+)
+
+// namespace 账号在 Notion 中的标识：多个账号同步到同一数据库时，
+// 滴答ID 带有账号前缀（"<账号>:<任务ID>"），避免不同账号的任务互相覆盖或被误标记完成
+type namespace struct {
+	prefix        string // 账号名，单账号时为空（滴答ID 即任务 ID）
+	owner         string // 负责人，为空则不写
+	ownerProperty string
+}
+
+func newNamespace(acc config.Account, ownerProperty string) namespace {
+	return namespace{prefix: acc.Name, owner: acc.Owner, ownerProperty: ownerProperty}
+}
+
+// key 任务写入 滴答ID 属性的值
+func (n namespace) key(taskID string) string {
+	if n.prefix == "" {
+		return taskID
+	}
+	return n.prefix + ":" + taskID
+}
+
+// taskID 从 滴答ID 属性的值中取出任务 ID，不属于该账号时返回 false
+func (n namespace) taskID(key string) (string, bool) {
+	if n.prefix == "" {
+		return key, !strings.Contains(key, ":")
+	}
+	id := strings.TrimPrefix(key, n.prefix+":")
+	return id, id != key
+}
+
+// properties 任务的 Notion 属性（不包含父任务关联），滴答ID 带账号前缀并写入负责人
+func (n namespace) properties(task dida.Task, projectName string) notion.Properties {
+	props := notion.TaskToProperties(task, projectName, "")
+	props["滴答ID"] = notion.DidaIDProperty(n.key(task.ID))
+	if n.owner != "" && n.ownerProperty != "" {
+		props[n.ownerProperty] = notion.OwnerProperty(n.owner)
+	}
+	return props
+}
+
+// newOAuth 按账号的区域和自定义地址创建 OAuth 客户端
+func newOAuth(acc config.Account) *dida.OAuth {
+	oauth := dida.NewOAuth(acc.DidaClientID, acc.DidaClientSecret, acc.DidaRedirectURL)
+	endpoints, err := dida.RegionEndpoints(acc.DidaRegion)
+	if err != nil {
+		// 区域已在加载配置时校验
+		endpoints = dida.Dida365
+	}
+	oauth.Endpoints = endpoints.Override(acc.DidaAPIBaseURL, acc.DidaAuthURL, acc.DidaTokenURL)
+	return oauth
+}
+
+// newSessions 为每个账号创建 session
+func newSessions(cfg *config.Config) ([]*session, error) {
+	sessions := make([]*session, 0, len(cfg.Accounts))
+	for _, acc := range cfg.Accounts {
+		sess, err := newSession(cfg, acc)
+		if err != nil {
+			if acc.Name != "" {
+				err = fmt.Errorf("账号 %s: %w", acc.Name, err)
+			}
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// syncAll 依次同步所有账号，结果累加到同一份报告；某个账号失败时继续同步其余账号，返回第一个错误
+func syncAll(ctx context.Context, sessions []*session, rep *report.Run, since time.Time) error {
+	var firstErr error
+	for _, sess := range sessions {
+		if shuttingDown() {
+			return errInterrupted
+		}
+		if name := sess.account.Name; name != "" {
+			logger.Info(fmt.Sprintf("\n===== 账号 %s =====", name), "account", name)
+		}
+
+		err := sess.sync(ctx, rep, since)
+		sess.needsRefresh = dida.IsUnauthorized(err)
+		if err != nil {
+			if sess.account.Name != "" {
+				logger.Error(fmt.Sprintf("账号 %s 同步失败", sess.account.Name), "account", sess.account.Name, "error", err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// refreshTokens 刷新所有账号中临近过期（或上次同步返回 401）的 token
+func refreshTokens(ctx context.Context, sessions []*session) {
+	for _, sess := range sessions {
+		if err := sess.refreshToken(ctx, sess.needsRefresh); err != nil {
+			logger.Error("刷新授权信息失败", "account", sess.account.Name, "error", err)
+		}
+	}
+}
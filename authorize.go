@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+)
+
+// runAuthorize 执行 OAuth 授权并保存 token；-headless 模式下适用于没有浏览器的服务器或 CI
+func runAuthorize(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("authorize", flag.ExitOnError)
+	headless := fs.Bool("headless", cfg.HeadlessAuth, "无浏览器模式：打印授权链接，从标准输入读取回调 URL")
+	allowBareCode := fs.Bool("allow-bare-code", false, "无浏览器模式下允许只粘贴授权码（不校验 state，仅在无法复制完整 URL 时使用）")
+	printToken := fs.Bool("print-token", false, "授权成功后将 token JSON 输出到标准输出（用于配置 DIDA_TOKEN secret）")
+	accountName := fs.String("account", "", "要授权的账号（配置了多个账号时必须指定）")
+	fs.Parse(args)
+
+	acc, err := cfg.Account(*accountName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfigError
+	}
+	if acc.DidaClientID == "" || acc.DidaClientSecret == "" {
+		fmt.Fprintln(os.Stderr, "请在 .env 文件中配置 DIDA_CLIENT_ID 和 DIDA_CLIENT_SECRET")
+		return exitConfigError
+	}
+
+	store, err := newTokenStore(acc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfigError
+	}
+
+	oauth := newOAuth(acc)
+
+	if *headless {
+		err = authorizeHeadless(oauth, os.Stdin, os.Stderr, *allowBareCode)
+	} else {
+		err = authorize(oauth)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "授权失败: %v\n", err)
+		return exitAuthError
+	}
+	saveToken(oauth, store)
+
+	// 无浏览器模式通常是为了获取 token 填入 CI secret，默认输出
+	if *printToken || *headless {
+		data, err := json.Marshal(oauth.GetToken())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "序列化 token 失败: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(os.Stderr, "\n以下为 token JSON，可直接粘贴到 GitHub 仓库的 %s secret：\n", acc.TokenEnv)
+		fmt.Println(string(data))
+	}
+	return exitOK
+}
+
+// authorizeHeadless 无浏览器授权：打印授权链接，由用户在任意设备上完成授权后，
+// 将浏览器跳转到的回调 URL 粘贴回来。allowBareCode 为 true 时也接受只粘贴 code 参数
+func authorizeHeadless(oauth *dida.OAuth, in io.Reader, out io.Writer, allowBareCode bool) error {
+	state, err := dida.GenerateState()
+	if err != nil {
+		return fmt.Errorf("生成 state 失败: %w", err)
+	}
+
+	fmt.Fprintln(out, "\n请在任意设备的浏览器中打开以下链接进行授权：")
+	fmt.Fprintln(out, oauth.GetAuthURL(state))
+	fmt.Fprintln(out, "\n授权后浏览器会跳转到回调地址（页面打不开也没关系），")
+	if allowBareCode {
+		fmt.Fprint(out, "请复制地址栏中的完整 URL（或其中的 code 参数）粘贴到这里并回车：\n> ")
+	} else {
+		fmt.Fprint(out, "请复制地址栏中的完整 URL 粘贴到这里并回车：\n> ")
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return fmt.Errorf("读取输入失败: %w", err)
+	}
+
+	code, err := parsePastedCallback(strings.TrimSpace(line), state, allowBareCode)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	logger.Info("正在获取 token...")
+	if _, err := oauth.ExchangeToken(ctx, code); err != nil {
+		return fmt.Errorf("获取 token 失败: %w", err)
+	}
+	return nil
+}
+
+// parsePastedCallback 解析粘贴的回调 URL 并校验 state。只粘贴授权码时无法校验 state，
+// 需要 allowBareCode 显式允许
+func parsePastedCallback(input, expectedState string, allowBareCode bool) (string, error) {
+	if input == "" {
+		return "", fmt.Errorf("未输入回调 URL")
+	}
+
+	if !strings.Contains(input, "?") && !strings.Contains(input, "=") {
+		if !allowBareCode {
+			return "", fmt.Errorf("请粘贴包含 code 和 state 参数的完整回调 URL（确实只能提供授权码时使用 -allow-bare-code）")
+		}
+		logger.Warn("只输入了授权码，无法校验 state")
+		return input, nil
+	}
+
+	query := input
+	if i := strings.Index(input, "?"); i >= 0 {
+		query = input[i+1:]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("无法解析回调 URL: %w", err)
+	}
+	return dida.ParseCallbackParams(values).Validate(expectedState)
+}
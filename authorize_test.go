@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"dida-to-notion-sync/logging"
+)
+
+func TestParsePastedCallback(t *testing.T) {
+	oldLogger := logger
+	logger = logging.Nop()
+	defer func() { logger = oldLogger }()
+
+	tests := []struct {
+		name          string
+		input         string
+		allowBareCode bool
+		want          string
+		wantErr       bool
+	}{
+		{name: "full url", input: "http://localhost:8080/callback?code=abc&state=s1", want: "abc"},
+		{name: "query only", input: "code=abc&state=s1", want: "abc"},
+		{name: "state mismatch", input: "http://localhost:8080/callback?code=abc&state=other", wantErr: true},
+		{name: "missing state", input: "http://localhost:8080/callback?code=abc", wantErr: true},
+		{name: "denied", input: "http://localhost:8080/callback?error=access_denied&state=s1", wantErr: true},
+		{name: "empty", input: "", allowBareCode: true, wantErr: true},
+		{name: "bare code rejected", input: "abc", wantErr: true},
+		{name: "bare code allowed", input: "abc", allowBareCode: true, want: "abc"},
+		// 允许裸授权码时，完整 URL 仍然校验 state
+		{name: "allowed but mismatched url", input: "code=abc&state=other", allowBareCode: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePastedCallback(tt.input, "s1", tt.allowBareCode)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %q, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
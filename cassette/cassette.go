@@ -0,0 +1,380 @@
+// Package cassette 录制和回放 HTTP 请求，用真实 API 的响应作为回归测试的固定数据。
+//
+// 录制模式下 Recorder 把请求转发给真实服务器，并把请求和响应脱敏后保存到 cassette 文件；
+// 回放模式下从文件中查找匹配的请求（方法、路径、查询参数和请求体）并直接返回录制的响应。
+// 录制时不保存任何请求头，响应头只保留 Content-Type 和 Retry-After
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mode 录制或回放
+type Mode int
+
+const (
+	Replay Mode = iota // 回放已录制的响应
+	Record             // 请求真实服务器并录制
+)
+
+// ModeFromEnv 环境变量 CASSETTE_RECORD 非空时为录制模式，否则为回放模式
+func ModeFromEnv() Mode {
+	if os.Getenv("CASSETTE_RECORD") != "" {
+		return Record
+	}
+	return Replay
+}
+
+// Cassette 录制文件的内容
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction 一次请求和对应的响应
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request 录制的请求；Body 为 JSON 请求体，非 JSON 时保存在 Text 中
+type Request struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Text   string          `json:"text,omitempty"`
+}
+
+// Response 录制的响应；Body 为 JSON 响应体，非 JSON 时保存在 Text 中
+type Response struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    json.RawMessage     `json:"body,omitempty"`
+	Text    string              `json:"text,omitempty"`
+}
+
+// keptHeaders 录制时保留的响应头
+var keptHeaders = []string{"Content-Type", "Retry-After"}
+
+// Option Recorder 配置项
+type Option func(*Recorder)
+
+// WithTransport 设置录制时转发请求使用的 Transport，默认为 http.DefaultTransport
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithScrubKeys 录制和匹配时，把 JSON 中这些键的字符串值替换为占位符。
+// 占位符由原值的哈希生成，同一个值总是得到同一个占位符，请求和响应之间的引用关系不变
+func WithScrubKeys(keys ...string) Option {
+	return func(r *Recorder) {
+		for _, k := range keys {
+			r.scrubKeys[k] = true
+		}
+	}
+}
+
+// WithKeep 匹配 pattern 的值不替换为占位符（如任务 ID）
+func WithKeep(pattern *regexp.Regexp) Option {
+	return func(r *Recorder) {
+		r.keep = append(r.keep, pattern)
+	}
+}
+
+// WithReplacement 录制和匹配时，把 URL 和请求/响应体中出现的 old 替换为 new（如数据库 ID、用户名）
+func WithReplacement(old, new string) Option {
+	return func(r *Recorder) {
+		if old != "" {
+			r.replacements = append(r.replacements, old, new)
+		}
+	}
+}
+
+// Recorder 录制或回放请求的 http.RoundTripper
+type Recorder struct {
+	path         string
+	mode         Mode
+	transport    http.RoundTripper
+	scrubKeys    map[string]bool
+	keep         []*regexp.Regexp
+	replacements []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New 创建 Recorder。回放模式下读取 path，文件不存在时返回错误；录制模式下在 Stop 时写入 path
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		scrubKeys: make(map[string]bool),
+		cassette:  Cassette{Version: 1},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if mode == Replay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+		}
+		if r.cassette.Version != 1 {
+			return nil, fmt.Errorf("unsupported cassette version %d", r.cassette.Version)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Mode 返回当前模式
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client 返回使用该 Recorder 的 HTTP 客户端
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop 录制模式下把录制的请求写入文件；回放模式下什么也不做
+func (r *Recorder) Stop() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// Remaining 回放模式下尚未被请求的录制，格式为 "GET /open/v1/project"
+func (r *Recorder) Remaining() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var remaining []string
+	for i, used := range r.used {
+		if !used {
+			req := r.cassette.Interactions[i].Request
+			remaining = append(remaining, req.Method+" "+requestPath(req.URL))
+		}
+	}
+	return remaining
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	recorded := Request{Method: req.Method, URL: r.scrubString(req.URL.String())}
+	recorded.Body, recorded.Text = r.scrubBody(body)
+
+	if r.mode == Replay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, body, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte, recorded Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request:  recorded,
+		Response: Response{Status: resp.StatusCode, Headers: make(map[string][]string)},
+	}
+	for _, h := range keptHeaders {
+		if v := resp.Header[h]; len(v) > 0 {
+			interaction.Response.Headers[h] = v
+		}
+	}
+	interaction.Response.Body, interaction.Response.Text = r.scrubBody(respBody)
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := requestPath(recorded.URL)
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !matches(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+
+		resp := interaction.Response
+		body := []byte(resp.Text)
+		if len(resp.Body) > 0 {
+			body = resp.Body
+		}
+		header := make(http.Header)
+		for k, v := range resp.Headers {
+			header[http.CanonicalHeaderKey(k)] = v
+		}
+		return &http.Response{
+			StatusCode:    resp.Status,
+			Status:        fmt.Sprintf("%d %s", resp.Status, http.StatusText(resp.Status)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s: no recorded interaction for %s %s %s", r.path, recorded.Method, path, describeBody(recorded))
+}
+
+// matches 判断录制的请求与当前请求是否相同；主机不参与比较，回放时可以使用任意 API 地址
+func matches(rec, req Request) bool {
+	if rec.Method != req.Method || requestPath(rec.URL) != requestPath(req.URL) || rec.Text != req.Text {
+		return false
+	}
+	return equalJSON(rec.Body, req.Body)
+}
+
+// requestPath URL 中的路径和查询参数
+func requestPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.RequestURI()
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	na, err1 := normalizeJSON(a)
+	nb, err2 := normalizeJSON(b)
+	return err1 == nil && err2 == nil && bytes.Equal(na, nb)
+}
+
+func normalizeJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func describeBody(req Request) string {
+	if len(req.Body) > 0 {
+		return string(req.Body)
+	}
+	return req.Text
+}
+
+// scrubBody 脱敏请求或响应体：JSON 返回紧凑的脱敏 JSON，否则返回替换后的文本
+func (r *Recorder) scrubBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+	text := r.scrubString(string(body))
+
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, text
+	}
+	data, err := json.Marshal(r.scrubValue(v))
+	if err != nil {
+		return nil, text
+	}
+	return data, ""
+}
+
+func (r *Recorder) scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if s, ok := item.(string); ok && r.scrubKeys[k] {
+				v[k] = r.placeholder(s)
+			} else {
+				v[k] = r.scrubValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.scrubValue(item)
+		}
+	}
+	return v
+}
+
+// placeholder 值的占位符，空字符串和匹配 WithKeep 的值保持不变
+func (r *Recorder) placeholder(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, re := range r.keep {
+		if re.MatchString(s) {
+			return s
+		}
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "scrubbed-" + hex.EncodeToString(sum[:4])
+}
+
+func (r *Recorder) scrubString(s string) string {
+	if len(r.replacements) == 0 {
+		return s
+	}
+	return strings.NewReplacer(r.replacements...).Replace(s)
+}
@@ -0,0 +1,111 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecordScrubsAndReplays(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		w.Write([]byte(`{"id":"0123456789abcdef01234567","title":"私人标题","owner":"alice@example.com","items":[{"title":"私人标题"},{"title":"0123456789abcdef01234567"}]}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	opts := []Option{
+		WithScrubKeys("title"),
+		WithKeep(regexp.MustCompile(`^[0-9a-f]{24}$`)),
+		WithReplacement("alice@example.com", "user@example.com"),
+	}
+
+	rec, err := New(path, Record, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("POST", srv.URL+"/v1/items?limit=1", strings.NewReader(`{"title":"私人标题","n":1}`))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	resp, err := rec.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "私人标题") {
+		t.Errorf("recording must return the real response, got %s", body)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"私人标题", "alice@example.com", "secret-token", "secret-cookie"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), "0123456789abcdef01234567") {
+		t.Errorf("kept value was scrubbed:\n%s", data)
+	}
+
+	// 回放时主机不同也能匹配，请求体中的同一个值得到同一个占位符
+	replay, err := New(path, Replay, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("POST", "https://api.example.com/v1/items?limit=1", strings.NewReader(`{"n":1,"title":"私人标题"}`))
+	resp, err = replay.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/json" || resp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("status %d, headers %v", resp.StatusCode, resp.Header)
+	}
+	if !strings.Contains(string(body), "user@example.com") || strings.Contains(string(body), "私人标题") {
+		t.Errorf("replayed body = %s", body)
+	}
+	if remaining := replay.Remaining(); len(remaining) != 0 {
+		t.Errorf("remaining = %v", remaining)
+	}
+
+	// 每条录制只回放一次
+	req, _ = http.NewRequest("POST", "https://api.example.com/v1/items?limit=1", strings.NewReader(`{"n":1,"title":"私人标题"}`))
+	if _, err := replay.Client().Do(req); err == nil {
+		t.Error("expected error for a request with no remaining recording")
+	}
+}
+
+func TestReplayRejectsDifferentBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	err := ioutil.WriteFile(path, []byte(`{"version":1,"interactions":[
+		{"request":{"method":"POST","url":"https://api.example.com/batch","body":{"status":2}},
+		 "response":{"status":200,"body":{}}}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := New(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"", `{"status":0}`} {
+		req, _ := http.NewRequest("POST", "https://api.example.com/batch", strings.NewReader(body))
+		if _, err := rec.Client().Do(req); err == nil {
+			t.Errorf("body %q matched recording with a different body", body)
+		}
+	}
+	if got := rec.Remaining(); len(got) != 1 || got[0] != "POST /batch" {
+		t.Errorf("remaining = %v", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Package clock 抽象时间相关的操作，便于在测试中使用可控的时钟
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock 获取当前时间和等待
+type Clock interface {
+	Now() time.Time
+	// Sleep 等待 d，ctx 取消时提前返回 ctx.Err()
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// Real 返回使用系统时间的时钟
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fake 手动控制的时钟：Sleep 立即返回并把时间推进 d，同时记录每次等待的时长
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+// NewFake 创建从 now 开始的时钟
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sleeps = append(f.sleeps, d)
+	if d > 0 {
+		f.now = f.now.Add(d)
+	}
+	return nil
+}
+
+// Advance 把时间推进 d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Sleeps 返回至今所有 Sleep 调用的时长
+func (f *Fake) Sleeps() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.sleeps...)
+}
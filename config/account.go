@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"dida-to-notion-sync/dida"
+)
+
+// Account 一个滴答清单账号及其同步目标
+type Account struct {
+	// Name 账号名；多账号时作为 滴答ID 的前缀（"<Name>:<任务ID>"），单账号时为空
+	Name string
+	// Owner 写入 Notion 负责人属性的值，为空则不写
+	Owner string
+
+	// 滴答清单
+	DidaClientID     string
+	DidaClientSecret string
+	DidaRedirectURL  string
+	DidaRegion       string // dida365（默认）或 ticktick
+	DidaAPIBaseURL   string // 自定义 API 地址，覆盖区域默认值
+	DidaAuthURL      string // 自定义 OAuth 授权地址
+	DidaTokenURL     string // 自定义 OAuth token 地址
+
+	// Notion
+	NotionToken      string
+	NotionDatabaseID string
+
+	// token 存储
+	TokenStore          string // file, env, encrypted, command 或 keyring
+	TokenFile           string // file / encrypted 使用的文件路径
+	TokenEnv            string // env 读取的环境变量名
+	TokenPassphrase     string // encrypted 使用的口令
+	TokenCommand        string // command 调用的外部命令
+	TokenKeyringService string // keyring 中的服务名
+	TokenKeyringAccount string // keyring 中的账号名
+
+	// GitHubSecretName token 刷新后写回的 GitHub Actions secret 名称，为空则不写回
+	GitHubSecretName string
+}
+
+// accountNamePattern 账号名只允许小写字母、数字、- 和 _（不能包含 滴答ID 前缀的分隔符 ":"）
+var accountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// loadAccounts 加载账号配置。
+//
+// 未设置 DIDA_ACCOUNTS 时只有一个无名账号，使用 DIDA_CLIENT_ID 等变量，与单账号时的行为相同。
+// 设置 DIDA_ACCOUNTS=alice,bob 后，每个账号的变量以大写账号名为前缀（如 ALICE_DIDA_CLIENT_ID），
+// 未设置时使用无前缀的值（可共用 OAuth 应用和 Notion 数据库）；token 文件、token 环境变量和
+// GitHub secret 名称默认按账号区分，不会共用
+func loadAccounts() ([]Account, error) {
+	names := splitList(os.Getenv("DIDA_ACCOUNTS"))
+	if len(names) == 0 {
+		acc, err := loadAccount("", "")
+		if err != nil {
+			return nil, err
+		}
+		return []Account{acc}, nil
+	}
+
+	seen := make(map[string]bool)
+	accounts := make([]Account, 0, len(names))
+	for _, name := range names {
+		if !accountNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("无效的账号名: %q（只能包含小写字母、数字、- 和 _）", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("账号名重复: %q", name)
+		}
+		seen[name] = true
+
+		acc, err := loadAccount(name, strings.ToUpper(strings.Replace(name, "-", "_", -1))+"_")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts, nil
+}
+
+func loadAccount(name, prefix string) (Account, error) {
+	// env 读取账号变量，未设置时使用无前缀的值
+	env := func(key, fallback string) string {
+		if value, ok := os.LookupEnv(prefix + key); ok {
+			return value
+		}
+		return getEnv(key, fallback)
+	}
+	// own 读取账号变量，未设置时在无前缀的值后加上 suffix，避免账号之间共用
+	own := func(key, fallback, suffix string) string {
+		if value, ok := os.LookupEnv(prefix + key); ok {
+			return value
+		}
+		value := getEnv(key, fallback)
+		if name == "" || value == "" {
+			return value
+		}
+		return value + suffix
+	}
+	upper := strings.TrimSuffix(prefix, "_")
+
+	acc := Account{
+		Name:                name,
+		Owner:               getEnv(prefix+"DIDA_OWNER", name),
+		DidaClientID:        env("DIDA_CLIENT_ID", ""),
+		DidaClientSecret:    env("DIDA_CLIENT_SECRET", ""),
+		DidaRedirectURL:     env("DIDA_REDIRECT_URL", ""),
+		DidaRegion:          strings.ToLower(env("DIDA_REGION", "dida365")),
+		DidaAPIBaseURL:      env("DIDA_API_BASE_URL", ""),
+		DidaAuthURL:         env("DIDA_AUTH_URL", ""),
+		DidaTokenURL:        env("DIDA_TOKEN_URL", ""),
+		NotionToken:         env("NOTION_TOKEN", ""),
+		NotionDatabaseID:    env("NOTION_DATABASE_ID", ""),
+		TokenStore:          env("DIDA_TOKEN_STORE", "file"),
+		TokenFile:           own("DIDA_TOKEN_FILE", ".token", "."+name),
+		TokenEnv:            own("DIDA_TOKEN_ENV", "DIDA_TOKEN", "_"+upper),
+		TokenPassphrase:     env("DIDA_TOKEN_PASSPHRASE", ""),
+		TokenCommand:        env("DIDA_TOKEN_COMMAND", ""),
+		TokenKeyringService: env("DIDA_TOKEN_KEYRING_SERVICE", "dida-to-notion-sync"),
+		TokenKeyringAccount: name,
+		GitHubSecretName:    own("DIDA_TOKEN_GITHUB_SECRET", "", "_"+upper),
+	}
+	if name == "" {
+		// 单账号时沿用以 client ID 作为密钥环账号名
+		acc.TokenKeyringAccount = acc.DidaClientID
+	}
+
+	// 与创建客户端时使用同一份区域名称，避免两处接受的取值不一致
+	if _, err := dida.RegionEndpoints(acc.DidaRegion); err != nil {
+		return Account{}, fmt.Errorf("%s无效的服务区域: %q（可选 dida365, ticktick）", acc.label(), acc.DidaRegion)
+	}
+
+	switch acc.TokenStore {
+	case "file", "env", "encrypted", "command", "keyring":
+	default:
+		return Account{}, fmt.Errorf("%s无效的 token 存储: %q（可选 file, env, encrypted, command, keyring）", acc.label(), acc.TokenStore)
+	}
+	return acc, nil
+}
+
+// label 用于错误信息的账号前缀
+func (a Account) label() string {
+	if a.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("账号 %s: ", a.Name)
+}
+
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
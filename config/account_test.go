@@ -0,0 +1,21 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadAccountRegion(t *testing.T) {
+	defer os.Unsetenv("DIDA_REGION")
+	for _, region := range []string{"dida365", "dida", "DIDA365", "ticktick", "TickTick"} {
+		os.Setenv("DIDA_REGION", region)
+		if _, err := loadAccount("", ""); err != nil {
+			t.Errorf("DIDA_REGION=%s: %v", region, err)
+		}
+	}
+
+	os.Setenv("DIDA_REGION", "todoist")
+	if _, err := loadAccount("", ""); err == nil {
+		t.Error("DIDA_REGION=todoist accepted")
+	}
+}
@@ -2,19 +2,127 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	// 滴答清单
-	DidaClientID     string
-	DidaClientSecret string
-	DidaRedirectURL  string
+	// Accounts 滴答清单账号，至少有一个
+	Accounts []Account
 
-	// Notion
-	NotionToken      string
-	NotionDatabaseID string
+	HeadlessAuth bool // 无浏览器授权：从标准输入读取回调 URL
+
+	// 滴答清单请求
+	DidaConcurrency     int           // 并发获取项目和补充获取子任务时的最大并发请求数
+	DidaRequestInterval time.Duration // 相邻两个请求的最小间隔，0 表示不限流
+
+	// 刷新后写回 GitHub Actions secret（secret 名称见 Account.GitHubSecretName）
+	GitHubSecretToken string // 有仓库 secrets 写权限的 token
+	GitHubRepository  string // owner/repo
+	GitHubAPIURL      string // GitHub REST API 地址
+
+	// NotionOwnerProperty 写入账号负责人的 Notion 属性名（select 类型）
+	NotionOwnerProperty string
+
+	// NotionArchiveDuplicates 为 true 时，同一滴答ID 有多个页面的，保留最早创建的页面并归档其余页面
+	NotionArchiveDuplicates bool
+
+	// 运行报告与状态
+	ReportFile  string // 每次运行的 JSON 报告输出路径，为空则不输出
+	StateFile   string // 本地状态文件路径
+	HistorySize int    // 在状态文件中保留的运行记录数，0 表示不保留
+
+	// Incremental 为 true 时只更新上次成功同步之后修改过的任务
+	Incremental bool
+
+	// 守护模式
+	DaemonInterval   time.Duration // 同步间隔
+	DaemonCron       string        // cron 表达式，设置后代替 DaemonInterval
+	DaemonMaxBackoff time.Duration // 连续失败时的最大退避时间
+
+	// Notion 变更监听（Notion → 滴答清单 状态近实时同步）
+	NotionWebhookAddr   string        // webhook 监听地址，为空则不启用
+	NotionWebhookPath   string        // webhook 路径
+	NotionWebhookSecret string        // webhook 签名密钥（订阅验证时收到的 verification_token）
+	NotionPollInterval  time.Duration // 轮询间隔，0 表示不轮询
+
+	// 日志
+	LogFormat string // text 或 json
+	LogLevel  string // debug, info, warn, error
+
+	// 指标
+	MetricsAddr    string // /metrics 监听地址，为空则不启用
+	MetricsPushURL string // Pushgateway 地址，为空则不推送
+	MetricsJob     string // 推送时使用的 job 名称
+
+	// FailureThreshold 允许的失败任务数，超过后以非零退出码结束
+	FailureThreshold FailureThreshold
+
+	// MaxCompleteFraction 一次运行中因滴答清单中已不存在而标记完成的页面占账号页面的最大比例，
+	// 超过时不标记并以非零退出码结束；0 表示不检查
+	MaxCompleteFraction float64
+	Force               bool // 命令行 -force：跳过 MaxCompleteFraction 检查
+}
+
+// Account 按名称查找账号；name 为空且只有一个账号时返回该账号
+func (c *Config) Account(name string) (Account, error) {
+	if name == "" && len(c.Accounts) == 1 {
+		return c.Accounts[0], nil
+	}
+	names := make([]string, len(c.Accounts))
+	for i, acc := range c.Accounts {
+		if acc.Name == name {
+			return acc, nil
+		}
+		names[i] = acc.Name
+	}
+	if name == "" {
+		return Account{}, fmt.Errorf("配置了多个账号，请指定账号（%s）", strings.Join(names, ", "))
+	}
+	return Account{}, fmt.Errorf("未知的账号: %q（%s）", name, strings.Join(names, ", "))
+}
+
+// FailureThreshold 失败阈值，可以是绝对数量或占任务总数的百分比
+type FailureThreshold struct {
+	Count   int     // 允许的最大失败数
+	Percent float64 // 允许的最大失败百分比，大于 0 时代替 Count 生效
+}
+
+// Exceeded 判断失败数是否超过阈值；失败数多于 total（如没有任务时完成状态写入失败）时按全部失败计算
+func (t FailureThreshold) Exceeded(failed, total int) bool {
+	if t.Percent > 0 {
+		if failed == 0 {
+			return false
+		}
+		if total < failed {
+			total = failed
+		}
+		return float64(failed)*100/float64(total) > t.Percent
+	}
+	return failed > t.Count
+}
+
+// ParseFailureThreshold 解析失败阈值，格式为 "5"（绝对数量）或 "10%"（百分比）
+func ParseFailureThreshold(value string) (FailureThreshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return FailureThreshold{}, nil
+	}
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return FailureThreshold{}, fmt.Errorf("无效的失败阈值: %q", value)
+		}
+		return FailureThreshold{Percent: percent}, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return FailureThreshold{}, fmt.Errorf("无效的失败阈值: %q", value)
+	}
+	return FailureThreshold{Count: count}, nil
 }
 
 func Load() (*Config, error) {
@@ -23,15 +131,99 @@ func Load() (*Config, error) {
 		// .env 文件不存在不是错误
 	}
 
+	threshold, err := ParseFailureThreshold(os.Getenv("SYNC_FAILURE_THRESHOLD"))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := loadAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	githubToken := os.Getenv("DIDA_TOKEN_GITHUB_PAT")
+	githubRepo := os.Getenv("GITHUB_REPOSITORY")
+	for _, acc := range accounts {
+		if acc.GitHubSecretName != "" && (githubToken == "" || githubRepo == "") {
+			return nil, fmt.Errorf("写回 GitHub secret 需要配置 DIDA_TOKEN_GITHUB_PAT 和 GITHUB_REPOSITORY")
+		}
+	}
+
 	return &Config{
-		DidaClientID:     os.Getenv("DIDA_CLIENT_ID"),
-		DidaClientSecret: os.Getenv("DIDA_CLIENT_SECRET"),
-		DidaRedirectURL:  os.Getenv("DIDA_REDIRECT_URL"),
-		NotionToken:      os.Getenv("NOTION_TOKEN"),
-		NotionDatabaseID: os.Getenv("NOTION_DATABASE_ID"),
+		Accounts:                accounts,
+		HeadlessAuth:            getEnvBool("DIDA_HEADLESS_AUTH", false),
+		DidaConcurrency:         getEnvInt("DIDA_CONCURRENCY", 4),
+		DidaRequestInterval:     getEnvDuration("DIDA_REQUEST_INTERVAL", 100*time.Millisecond),
+		GitHubSecretToken:       githubToken,
+		GitHubRepository:        githubRepo,
+		GitHubAPIURL:            getEnv("GITHUB_API_URL", "https://api.github.com"),
+		NotionOwnerProperty:     getEnv("NOTION_OWNER_PROPERTY", "负责人"),
+		NotionArchiveDuplicates: getEnvBool("NOTION_ARCHIVE_DUPLICATES", false),
+		ReportFile:              getEnv("SYNC_REPORT_FILE", "sync-report.json"),
+		StateFile:               getEnv("SYNC_STATE_FILE", ".sync_state.json"),
+		HistorySize:             getEnvInt("SYNC_HISTORY_SIZE", 0),
+		FailureThreshold:        threshold,
+		MaxCompleteFraction:     getEnvFloat("SYNC_MAX_COMPLETE_FRACTION", 0.2),
+		Incremental:             getEnvBool("SYNC_INCREMENTAL", false),
+		DaemonInterval:          getEnvDuration("DAEMON_INTERVAL", 15*time.Minute),
+		DaemonCron:              os.Getenv("DAEMON_CRON"),
+		DaemonMaxBackoff:        getEnvDuration("DAEMON_MAX_BACKOFF", time.Hour),
+		NotionWebhookAddr:       os.Getenv("NOTION_WEBHOOK_ADDR"),
+		NotionWebhookPath:       getEnv("NOTION_WEBHOOK_PATH", "/notion/webhook"),
+		NotionWebhookSecret:     os.Getenv("NOTION_WEBHOOK_SECRET"),
+		NotionPollInterval:      getEnvDuration("NOTION_POLL_INTERVAL", 0),
+		LogFormat:               getEnv("LOG_FORMAT", "text"),
+		LogLevel:                getEnv("LOG_LEVEL", "info"),
+		MetricsAddr:             os.Getenv("METRICS_ADDR"),
+		MetricsPushURL:          os.Getenv("METRICS_PUSH_URL"),
+		MetricsJob:              getEnv("METRICS_JOB", "dida_to_notion_sync"),
 	}, nil
 }
 
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt 读取整数环境变量，未设置或无法解析时返回默认值
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvFloat 读取小数环境变量，未设置或无法解析时返回默认值
+func getEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvBool 读取布尔环境变量，未设置或无法解析时返回默认值
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration 读取时长环境变量（如 15m、1h），未设置或无法解析时返回默认值
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 func loadEnvFile(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -0,0 +1,65 @@
+package config
+
+import "testing"
+
+func TestParseFailureThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    FailureThreshold
+		wantErr bool
+	}{
+		{value: "", want: FailureThreshold{}},
+		{value: "0", want: FailureThreshold{}},
+		{value: " 5 ", want: FailureThreshold{Count: 5}},
+		{value: "10%", want: FailureThreshold{Percent: 10}},
+		{value: "2.5%", want: FailureThreshold{Percent: 2.5}},
+		{value: "100%", want: FailureThreshold{Percent: 100}},
+		{value: "-1", wantErr: true},
+		{value: "101%", wantErr: true},
+		{value: "-5%", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "%", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFailureThreshold(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseFailureThreshold(%q) = %+v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseFailureThreshold(%q) = %+v, %v; want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestFailureThresholdExceeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold FailureThreshold
+		failed    int
+		total     int
+		want      bool
+	}{
+		{"default, no failures", FailureThreshold{}, 0, 10, false},
+		{"default, one failure", FailureThreshold{}, 1, 10, true},
+		{"count, at limit", FailureThreshold{Count: 3}, 3, 10, false},
+		{"count, over limit", FailureThreshold{Count: 3}, 4, 10, true},
+		{"percent, at limit", FailureThreshold{Percent: 10}, 1, 10, false},
+		{"percent, over limit", FailureThreshold{Percent: 10}, 2, 10, true},
+		{"percent, small share of many", FailureThreshold{Percent: 10}, 9, 100, false},
+		{"percent, 100% allows everything", FailureThreshold{Percent: 100}, 10, 10, false},
+		// 没有任务时：没有失败不算超过，有失败按全部失败计算
+		{"percent, zero tasks", FailureThreshold{Percent: 10}, 0, 0, false},
+		{"percent, zero tasks with failures", FailureThreshold{Percent: 10}, 2, 0, true},
+		{"count, zero tasks with failures", FailureThreshold{Count: 2}, 2, 0, false},
+		{"percent, more failures than tasks", FailureThreshold{Percent: 50}, 3, 2, true},
+	}
+	for _, tt := range tests {
+		if got := tt.threshold.Exceeded(tt.failed, tt.total); got != tt.want {
+			t.Errorf("%s: Exceeded(%d, %d) = %v, want %v", tt.name, tt.failed, tt.total, got, tt.want)
+		}
+	}
+}
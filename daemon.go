@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/report"
+	"dida-to-notion-sync/schedule"
+)
+
+// runDaemon 常驻运行，按调度执行增量同步，直到收到停止信号
+func runDaemon(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	interval := fs.Duration("interval", cfg.DaemonInterval, "同步间隔")
+	cronExpr := fs.String("cron", cfg.DaemonCron, "cron 表达式（分 时 日 月 周），设置后代替 -interval")
+	maxBackoff := fs.Duration("max-backoff", cfg.DaemonMaxBackoff, "连续失败时的最大退避时间")
+	fs.Parse(args)
+
+	sched, err := newSchedule(*interval, *cronExpr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfigError
+	}
+
+	sessions, err := newSessions(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeFor(err, nil, cfg.FailureThreshold)
+	}
+
+	if cfg.NotionWebhookAddr != "" || cfg.NotionPollInterval > 0 {
+		if err := startStatusListener(cfg, sessions); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitConfigError
+		}
+	}
+
+	logger.Info("守护模式已启动", "interval", interval.String(), "cron", *cronExpr)
+
+	ctx := context.Background()
+	failures := 0
+	next := time.Now()
+
+	for {
+		if !waitUntil(next) {
+			break
+		}
+
+		refreshTokens(ctx, sessions)
+		code := daemonRun(ctx, cfg, sessions)
+
+		if code == exitOK {
+			failures = 0
+		} else {
+			failures++
+		}
+		if shuttingDown() {
+			break
+		}
+
+		now := time.Now()
+		next = sched.Next(now)
+		if next.IsZero() {
+			// ParseCron 已拒绝永远不会触发的表达式，这里防止零值导致连续同步
+			logger.Error("无法计算下次同步时间，守护模式退出", "cron", *cronExpr)
+			return exitConfigError
+		}
+		if failures > 0 {
+			if retryAt := now.Add(backoff(failures, *interval, *maxBackoff)); retryAt.After(next) {
+				next = retryAt
+			}
+			logger.Warn(fmt.Sprintf("同步失败（连续 %d 次），将于 %s 重试", failures, next.Format(time.RFC3339)),
+				"failures", failures, "exit_code", code)
+		} else {
+			logger.Info(fmt.Sprintf("下次同步时间: %s", next.Format(time.RFC3339)))
+		}
+	}
+
+	logger.Info("守护模式已停止")
+	return exitOK
+}
+
+// daemonRun 执行一次增量同步并保存报告，返回该次运行的退出码
+func daemonRun(ctx context.Context, cfg *config.Config, sessions []*session) int {
+	rep := report.New()
+	err := syncAll(ctx, sessions, rep, lastSyncTime(cfg))
+	rep.Finish(err)
+
+	code := exitCodeFor(err, rep, cfg.FailureThreshold)
+	saveReport(cfg, rep, code == exitOK)
+	recordRunMetrics(rep, code)
+	printErrorSummary(os.Stderr, err, rep, code)
+	return code
+}
+
+// newSchedule 根据配置创建调度，cron 表达式优先
+func newSchedule(interval time.Duration, cronExpr string) (schedule.Schedule, error) {
+	if cronExpr != "" {
+		c, err := schedule.ParseCron(cronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 cron 表达式: %w", err)
+		}
+		return c, nil
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("无效的同步间隔: %v", interval)
+	}
+	return schedule.Every(interval), nil
+}
+
+// backoff 计算连续失败后的等待时间：从 base 开始指数增长，不超过 max
+func backoff(failures int, base, max time.Duration) time.Duration {
+	if base <= 0 || base > max {
+		base = time.Minute
+	}
+	d := base
+	for i := 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// waitUntil 等待到指定时间，期间收到停止信号则返回 false
+func waitUntil(t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-shutdown:
+		return false
+	}
+}
+
+// runListen 只运行 Notion 变更监听（不做定时同步），直到收到停止信号
+func runListen(cfg *config.Config) int {
+	if cfg.NotionWebhookAddr == "" && cfg.NotionPollInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "请配置 NOTION_WEBHOOK_ADDR 或 NOTION_POLL_INTERVAL")
+		return exitConfigError
+	}
+
+	sessions, err := newSessions(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeFor(err, nil, cfg.FailureThreshold)
+	}
+	if err := startStatusListener(cfg, sessions); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfigError
+	}
+
+	<-shutdown
+	logger.Info("监听已停止")
+	return exitOK
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/notion"
+)
+
+// 保留页面的选择策略
+const (
+	survivorRelations = "relations" // 关联最多的页面
+	survivorOldest    = "oldest"    // 最早创建的页面
+	survivorRecent    = "recent"    // 最近编辑的页面
+)
+
+// dedupeGroup 滴答ID 相同的一组页面：保留 survivor，归档 losers
+type dedupeGroup struct {
+	didaID   string
+	survivor notion.Page
+	losers   []notion.Page
+}
+
+// dedupeResult 去重结果统计
+type dedupeResult struct {
+	Groups   int // 有重复页面的滴答ID 数
+	Archived int // 归档的页面数
+	Updated  int // 迁移关联时更新的页面数
+	Skipped  int // 关联超过 25 项、无法完整迁移而没有归档的页面数
+	Failed   int // 失败的操作数
+}
+
+// runDedupe 查找滴答ID 相同的页面，保留一个页面并把其余页面的关联迁移到该页面后归档
+func runDedupe(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	strategy := fs.String("strategy", survivorOldest, "保留哪个页面: relations（关联最多）、oldest（最早创建）或 recent（最近编辑）")
+	dryRun := fs.Bool("dry-run", false, "只输出将要执行的操作，不修改 Notion")
+	accountName := fs.String("account", "", "只处理该账号的数据库（默认处理所有账号）")
+	fs.Parse(args)
+
+	switch *strategy {
+	case survivorRelations, survivorOldest, survivorRecent:
+	default:
+		fmt.Fprintf(os.Stderr, "未知的保留策略: %s\n", *strategy)
+		return exitConfigError
+	}
+
+	accounts := cfg.Accounts
+	if *accountName != "" {
+		acc, err := cfg.Account(*accountName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitConfigError
+		}
+		accounts = []config.Account{acc}
+	}
+
+	ctx := context.Background()
+	var total dedupeResult
+	seen := make(map[string]bool)
+	for _, acc := range accounts {
+		if acc.NotionToken == "" || acc.NotionDatabaseID == "" {
+			fmt.Fprintf(os.Stderr, "账号 %s 未配置 NOTION_TOKEN 或 NOTION_DATABASE_ID\n", acc.Name)
+			return exitConfigError
+		}
+		// 多个账号可以同步到同一个数据库，每个数据库只处理一次
+		if seen[acc.NotionDatabaseID] {
+			continue
+		}
+		seen[acc.NotionDatabaseID] = true
+
+		client := newNotionClient(cfg, acc)
+		pages, err := client.GetAllPages(ctx)
+		if err != nil {
+			err = fetchError("获取 Notion 页面失败", err)
+			fmt.Fprintln(os.Stderr, err)
+			return exitCodeFor(err, nil, cfg.FailureThreshold)
+		}
+		groups := findDuplicates(pages, *strategy)
+		logger.Infof("数据库 %s: %d 个页面，%d 个滴答ID 有重复页面", acc.NotionDatabaseID, len(pages), len(groups))
+
+		res := applyDedupe(ctx, client, pages, groups, *dryRun)
+		total.Groups += res.Groups
+		total.Archived += res.Archived
+		total.Updated += res.Updated
+		total.Skipped += res.Skipped
+		total.Failed += res.Failed
+		if shuttingDown() {
+			break
+		}
+	}
+
+	prefix := ""
+	if *dryRun {
+		prefix = "[dry-run] "
+	}
+	logger.Info(fmt.Sprintf("%s去重完成: %d 组重复，归档 %d 个页面，更新 %d 个页面的关联，跳过 %d，失败 %d",
+		prefix, total.Groups, total.Archived, total.Updated, total.Skipped, total.Failed),
+		"groups", total.Groups, "archived", total.Archived, "updated", total.Updated,
+		"skipped", total.Skipped, "failed", total.Failed)
+	if total.Failed > 0 {
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+// findDuplicates 按滴答ID 分组，返回有多个页面的组，按滴答ID 排序
+func findDuplicates(pages []notion.Page, strategy string) []dedupeGroup {
+	byID := make(map[string][]notion.Page)
+	for _, page := range pages {
+		if id, ok := extractDidaIDFromPage(page); ok {
+			byID[id] = append(byID[id], page)
+		}
+	}
+
+	var groups []dedupeGroup
+	for id, group := range byID {
+		if len(group) < 2 {
+			continue
+		}
+		ordered := orderBySurvivor(group, strategy)
+		groups = append(groups, dedupeGroup{didaID: id, survivor: ordered[0], losers: ordered[1:]})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].didaID < groups[j].didaID })
+	return groups
+}
+
+// orderBySurvivor 按保留的优先级排列页面，第一个为保留的页面；条件相同时保留最早创建的页面
+func orderBySurvivor(pages []notion.Page, strategy string) []notion.Page {
+	ordered := append([]notion.Page(nil), pages...)
+	notion.SortOldestFirst(ordered)
+	switch strategy {
+	case survivorRelations:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return relationCount(ordered[i]) > relationCount(ordered[j])
+		})
+	case survivorRecent:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].LastEditedTime.After(ordered[j].LastEditedTime)
+		})
+	}
+	return ordered
+}
+
+// relationCount 页面所有关联属性中的关联数
+func relationCount(page notion.Page) int {
+	n := 0
+	for name, prop := range page.Properties {
+		if prop.Type == notion.PropertyRelation {
+			n += len(page.Relation(name))
+		}
+	}
+	return n
+}
+
+// applyDedupe 迁移关联并归档重复页面：
+// 保留的页面合并被归档页面的关联，其他页面中指向被归档页面的关联改为指向保留的页面。
+// 关联超过 25 项时 API 只返回部分，涉及的重复页面不合并也不归档
+func applyDedupe(ctx context.Context, client *notion.Client, pages []notion.Page, groups []dedupeGroup, dryRun bool) dedupeResult {
+	res := dedupeResult{Groups: len(groups)}
+
+	replaced := make(map[string]string)      // 被归档页面 ID -> 保留页面 ID
+	merged := make(map[string][]notion.Page) // 保留页面 ID -> 被归档的页面
+	keep := make(map[string]bool)            // 关联迁移失败或无法完整迁移、暂不归档的页面
+	for i, g := range groups {
+		var losers []notion.Page
+		for _, loser := range g.losers {
+			if name, ok := partialRelation(loser); ok {
+				logger.Warn(fmt.Sprintf("关联属性 %s 超过 25 项，无法完整迁移，不归档该重复页面", name),
+					"task_id", g.didaID, "page_id", loser.ID)
+				res.Skipped++
+				continue
+			}
+			losers = append(losers, loser)
+			replaced[loser.ID] = g.survivor.ID
+		}
+		groups[i].losers = losers
+		merged[g.survivor.ID] = losers
+	}
+
+	for _, page := range pages {
+		if shuttingDown() {
+			return res
+		}
+		if _, ok := replaced[page.ID]; ok {
+			continue
+		}
+		props, blocked := movedRelations(page, merged[page.ID], replaced)
+		for _, id := range blocked {
+			if !keep[id] {
+				keep[id] = true
+				res.Skipped++
+			}
+		}
+		if len(props) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		key, _ := extractDidaIDFromPage(page)
+
+		if dryRun {
+			logger.Info(fmt.Sprintf("[dry-run] 将更新页面关联: %v", names), "task_id", key, "page_id", page.ID)
+			res.Updated++
+			continue
+		}
+		if _, err := client.UpdatePage(ctx, page.ID, props); err != nil {
+			logger.Error("更新页面关联失败", "task_id", key, "page_id", page.ID, "error", err)
+			res.Failed++
+			// 关联未迁移的页面不归档，否则关联会丢失；下次运行时重试
+			for _, loser := range merged[page.ID] {
+				keep[loser.ID] = true
+			}
+			for name := range props {
+				for _, id := range page.Relation(name) {
+					if _, ok := replaced[id]; ok {
+						keep[id] = true
+					}
+				}
+			}
+		} else {
+			logger.Info(fmt.Sprintf("已更新页面关联: %v", names), "task_id", key, "page_id", page.ID)
+			res.Updated++
+		}
+		throttle(ctx)
+	}
+
+	// 关联迁移后再归档
+	for _, g := range groups {
+		for _, loser := range g.losers {
+			if shuttingDown() {
+				return res
+			}
+			if keep[loser.ID] {
+				logger.Warn("关联未能完整迁移，暂不归档重复页面", "task_id", g.didaID, "page_id", loser.ID)
+				continue
+			}
+			if dryRun {
+				logger.Info("[dry-run] 将归档重复页面", "task_id", g.didaID, "page_id", loser.ID, "kept", g.survivor.ID)
+				res.Archived++
+				continue
+			}
+			if err := client.ArchivePage(ctx, loser.ID); err != nil {
+				logger.Error("归档重复页面失败", "task_id", g.didaID, "page_id", loser.ID, "error", err)
+				res.Failed++
+			} else {
+				logger.Info("已归档重复页面", "task_id", g.didaID, "page_id", loser.ID, "kept", g.survivor.ID)
+				res.Archived++
+			}
+			throttle(ctx)
+		}
+	}
+	return res
+}
+
+// partialRelation 返回页面中超过 25 项、API 只返回了部分的关联属性
+func partialRelation(page notion.Page) (string, bool) {
+	for name, prop := range page.Properties {
+		if prop.Type == notion.PropertyRelation && prop.HasMore {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// movedRelations 页面需要更新的关联属性：合并 losers 的关联（page 为保留页面时），
+// 把指向被归档页面的关联替换为保留页面并去重。关联超过 25 项时 API 只返回部分，该属性不做修改，
+// 其中的关联无法迁移的被归档页面在 blocked 中返回
+func movedRelations(page notion.Page, losers []notion.Page, replaced map[string]string) (props notion.Properties, blocked []string) {
+	props = notion.Properties{}
+	for name, prop := range page.Properties {
+		if prop.Type != notion.PropertyRelation {
+			continue
+		}
+		if prop.HasMore {
+			logger.Warn(fmt.Sprintf("关联属性 %s 超过 25 项，跳过迁移", name), "page_id", page.ID)
+			for _, loser := range losers {
+				if len(loser.Relation(name)) > 0 {
+					blocked = append(blocked, loser.ID)
+				}
+			}
+			for _, id := range page.Relation(name) {
+				if _, ok := replaced[id]; ok {
+					blocked = append(blocked, id)
+				}
+			}
+			continue
+		}
+
+		current := page.Relation(name)
+		ids := current
+		for _, loser := range losers {
+			ids = append(ids[:len(ids):len(ids)], loser.Relation(name)...)
+		}
+
+		var result []string
+		seen := map[string]bool{page.ID: true}
+		for _, id := range ids {
+			if to, ok := replaced[id]; ok {
+				id = to
+			}
+			if !seen[id] {
+				seen[id] = true
+				result = append(result, id)
+			}
+		}
+		if !equalStringSlices(result, current) {
+			props[name] = notion.NewRelation(result...)
+		}
+	}
+	return props, blocked
+}
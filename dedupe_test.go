@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/internal/fault"
+	"dida-to-notion-sync/notion"
+)
+
+// seedDuplicates 创建一组重复页面：parent1 最早创建但没有关联，parent2 与子任务互相关联
+func seedDuplicates(env *e2e) (parent1, parent2, child string) {
+	parent1 = env.notion.AddPage(testDatabaseID, notion.Properties{
+		"滴答ID": notion.DidaIDProperty("parent"),
+		"父任务":  notion.NewRelation(),
+		"子任务":  notion.NewRelation(),
+	})
+	env.clock.Advance(time.Minute)
+	parent2 = env.notion.AddPage(testDatabaseID, notion.Properties{
+		"滴答ID": notion.DidaIDProperty("parent"),
+		"父任务":  notion.NewRelation(),
+		"子任务":  notion.NewRelation(),
+	})
+	child = env.notion.AddPage(testDatabaseID, notion.Properties{
+		"滴答ID": notion.DidaIDProperty("child"),
+		"父任务":  notion.NewRelation(parent2),
+		"子任务":  notion.NewRelation(),
+	})
+	if _, err := env.sessions[0].notion.UpdatePage(context.Background(), parent2, notion.Properties{"子任务": notion.NewRelation(child)}); err != nil {
+		env.t.Fatal(err)
+	}
+	return parent1, parent2, child
+}
+
+func (env *e2e) dedupe(strategy string, dryRun bool) dedupeResult {
+	client := env.sessions[0].notion
+	pages, err := client.GetAllPages(context.Background())
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	return applyDedupe(context.Background(), client, pages, findDuplicates(pages, strategy), dryRun)
+}
+
+func TestDedupeMovesRelationsToOldestPage(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	parent1, parent2, child := seedDuplicates(env)
+
+	res := env.dedupe(survivorOldest, false)
+	if res.Groups != 1 || res.Archived != 1 || res.Updated != 2 || res.Failed != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	if !env.notion.Archived(parent2) || env.notion.Archived(parent1) {
+		t.Errorf("archived: parent1 %v, parent2 %v", env.notion.Archived(parent1), env.notion.Archived(parent2))
+	}
+	pages := env.pagesByKey()
+	if got := relationIDs(pages["parent"], "子任务"); !equalStringSlices(got, []string{child}) {
+		t.Errorf("survivor 子任务 = %v, want [%s]", got, child)
+	}
+	if got := relationIDs(pages["child"], "父任务"); !equalStringSlices(got, []string{parent1}) {
+		t.Errorf("child 父任务 = %v, want [%s]", got, parent1)
+	}
+
+	// 再次运行没有重复
+	if res := env.dedupe(survivorOldest, false); res != (dedupeResult{}) {
+		t.Errorf("second run = %+v", res)
+	}
+}
+
+func TestDedupeKeepsPageWithMostRelations(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	parent1, parent2, _ := seedDuplicates(env)
+
+	res := env.dedupe(survivorRelations, false)
+	if res.Archived != 1 || res.Updated != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	if !env.notion.Archived(parent1) || env.notion.Archived(parent2) {
+		t.Errorf("archived: parent1 %v, parent2 %v", env.notion.Archived(parent1), env.notion.Archived(parent2))
+	}
+	if got := relationIDs(env.pagesByKey()["child"], "父任务"); !equalStringSlices(got, []string{parent2}) {
+		t.Errorf("child 父任务 = %v", got)
+	}
+}
+
+func TestDedupeDryRunChangesNothing(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	parent1, parent2, _ := seedDuplicates(env)
+	before := len(env.notion.Requests())
+
+	res := env.dedupe(survivorRecent, true)
+	if res.Groups != 1 || res.Archived != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	if env.notion.Archived(parent1) || env.notion.Archived(parent2) {
+		t.Error("dry run archived a page")
+	}
+	for _, r := range env.notion.Requests()[before:] {
+		if r != "POST /v1/databases/"+testDatabaseID+"/query" {
+			t.Errorf("dry run sent %s", r)
+		}
+	}
+}
+
+func TestDedupeKeepsLoserWhenRelationMoveFails(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	_, parent2, child := seedDuplicates(env)
+	env.notion.InjectFault(fault.Fault{Method: "PATCH", Path: "/v1/pages/" + child, Status: http.StatusBadRequest})
+
+	res := env.dedupe(survivorOldest, false)
+	if res.Failed != 1 || res.Archived != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	if env.notion.Archived(parent2) {
+		t.Error("page still referenced by child was archived")
+	}
+}
+
+func TestDedupeKeepsLoserWithPartialRelations(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	parent1, parent2, _ := seedDuplicates(env)
+
+	client := env.sessions[0].notion
+	pages, err := client.GetAllPages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟 parent2 的子任务超过 25 项、API 只返回了部分
+	for i := range pages {
+		if pages[i].ID == parent2 {
+			prop := pages[i].Properties["子任务"]
+			prop.HasMore = true
+			pages[i].Properties["子任务"] = prop
+		}
+	}
+
+	res := applyDedupe(context.Background(), client, pages, findDuplicates(pages, survivorOldest), false)
+	if res.Skipped != 1 || res.Archived != 0 || res.Updated != 0 || res.Failed != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	if env.notion.Archived(parent2) || env.notion.Archived(parent1) {
+		t.Error("page with partial relations was archived")
+	}
+}
+
+func TestDedupeKeepsLoserReferencedByPartialRelation(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	parent1, parent2, child := seedDuplicates(env)
+
+	client := env.sessions[0].notion
+	pages, err := client.GetAllPages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 指向被归档页面的属性超过 25 项时无法替换，被归档页面暂不归档
+	for i := range pages {
+		if pages[i].ID == child {
+			prop := pages[i].Properties["父任务"]
+			prop.HasMore = true
+			pages[i].Properties["父任务"] = prop
+		}
+	}
+
+	res := applyDedupe(context.Background(), client, pages, findDuplicates(pages, survivorOldest), false)
+	if res.Skipped != 1 || res.Archived != 0 || res.Failed != 0 {
+		t.Fatalf("result = %+v", res)
+	}
+	if env.notion.Archived(parent2) || env.notion.Archived(parent1) {
+		t.Error("page still referenced by child was archived")
+	}
+}
@@ -0,0 +1,119 @@
+package dida
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// defaultRedirectURL 未配置 RedirectURL 时使用的回调地址
+const defaultRedirectURL = "http://localhost:8080/callback"
+
+// errStateMismatch 回调中的 state 与本次授权不一致
+var errStateMismatch = errors.New("state mismatch in callback")
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; display: flex; justify-content: center; margin-top: 15vh; color: #333; }
+.box { max-width: 480px; text-align: center; }
+h1 { font-size: 22px; color: {{if .OK}}#2e7d32{{else}}#c62828{{end}}; }
+p { line-height: 1.6; }
+</style>
+</head>
+<body>
+<div class="box">
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</div>
+</body>
+</html>
+`))
+
+// StartCallbackServer 按 RedirectURL 中的主机、端口和路径启动一个临时 HTTP 服务器接收 OAuth 回调，
+// 校验 state 后返回授权码。state 不匹配的请求会被拒绝并继续等待，授权被拒绝时返回错误
+func (o *OAuth) StartCallbackServer(ctx context.Context, state string) (string, error) {
+	u, err := url.Parse(o.RedirectURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	codeChan := make(chan string, 1)
+	errChan := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		code, err := ParseCallbackParams(r.URL.Query()).Validate(state)
+		switch {
+		case err == nil:
+			renderCallbackPage(w, http.StatusOK, true, "授权成功", "你可以关闭此页面并返回终端了。")
+			select {
+			case codeChan <- code:
+			default:
+			}
+		case errors.Is(err, errStateMismatch):
+			// 可能是伪造或过期的请求，不中断本次授权
+			renderCallbackPage(w, http.StatusBadRequest, false, "授权失败", "state 校验失败，请从终端中打印的链接重新发起授权。")
+		default:
+			renderCallbackPage(w, http.StatusBadRequest, false, "授权失败", err.Error())
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+	}()
+	defer server.Shutdown(context.Background())
+
+	select {
+	case code := <-codeChan:
+		return code, nil
+	case err := <-errChan:
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func renderCallbackPage(w http.ResponseWriter, status int, ok bool, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	callbackPage.Execute(w, struct {
+		OK             bool
+		Title, Message string
+	}{ok, title, message})
+}
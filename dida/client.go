@@ -1,65 +1,204 @@
 package dida
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/metrics"
 )
 
 const (
-	baseURL = "https://api.dida365.com/open/v1"
+	maxRetries         = 3
+	defaultUserAgent   = "dida-to-notion-sync"
+	defaultConcurrency = 4
+
+	// maxSubtaskDepth 补充获取子任务的最大层数，防止异常数据导致无限获取
+	maxSubtaskDepth = 10
 )
 
 // Client 滴答清单 API 客户端
 type Client struct {
-	oauth      *OAuth
-	httpClient *http.Client
+	oauth       *OAuth
+	baseURL     string
+	userAgent   string
+	timeout     time.Duration
+	httpClient  *http.Client
+	clock       clock.Clock
+	limiter     *RateLimiter
+	concurrency int
+	stats       Stats
+	log         *logging.Logger
+	metrics     *metrics.Metrics
+}
+
+// Stats API 调用统计
+type Stats struct {
+	Requests int64 // 发出的 HTTP 请求数（含重试）
+	Errors   int64 // 最终失败的请求数
+	Retries  int64 // 因限流或服务端错误而重试的次数
 }
 
 // NewClient 创建新的 API 客户端
-func NewClient(oauth *OAuth) *Client {
-	return &Client{
-		oauth:      oauth,
-		httpClient: http.DefaultClient,
+func NewClient(oauth *OAuth, opts ...Option) *Client {
+	c := &Client{
+		oauth:       oauth,
+		baseURL:     oauth.Endpoints.APIBaseURL,
+		userAgent:   defaultUserAgent,
+		httpClient:  http.DefaultClient,
+		clock:       clock.Real(),
+		concurrency: defaultConcurrency,
+		log:         logging.Nop(),
+	}
+	c.applyOptions(opts)
+	// 刷新 token 与 API 请求使用相同的 HTTP 客户端和 User-Agent
+	if oauth.HTTPClient == nil {
+		oauth.HTTPClient = c.httpClient
+	}
+	if oauth.UserAgent == "" {
+		oauth.UserAgent = c.userAgent
 	}
+	return c
+}
+
+// APIError 滴答清单 API 返回的错误响应
+type APIError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error: %s", e.Status)
+}
+
+// IsUnauthorized 判断错误是否由 token 无效或过期引起
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
 }
 
-// doRequest 执行 API 请求
-func (c *Client) doRequest(ctx context.Context, method, path string, result interface{}) error {
+// Stats 返回当前的 API 调用统计
+func (c *Client) Stats() Stats {
+	return Stats{
+		Requests: atomic.LoadInt64(&c.stats.Requests),
+		Errors:   atomic.LoadInt64(&c.stats.Errors),
+		Retries:  atomic.LoadInt64(&c.stats.Retries),
+	}
+}
+
+// doRequest 执行 API 请求，遇到限流或服务端错误时自动重试
+func (c *Client) doRequest(ctx context.Context, method, path string, body, result interface{}) error {
+	err := c.doRequestWithRetry(ctx, method, path, body, result)
+	if err != nil {
+		atomic.AddInt64(&c.stats.Errors, 1)
+	}
+	return err
+}
+
+func (c *Client) doRequestWithRetry(ctx context.Context, method, path string, body, result interface{}) error {
 	token := c.oauth.GetToken()
 	if token == nil {
 		return fmt.Errorf("not authenticated")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, nil)
-	if err != nil {
-		return err
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
-	req.Header.Set("Content-Type", "application/json")
+	endpoint := method + " " + metrics.EndpointLabel(path, "project", "task")
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if jsonBody != nil {
+			reqBody = bytes.NewReader(jsonBody)
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+		wait, err := c.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			c.metrics.ObserveRateLimitWait("dida", wait)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", c.userAgent)
+
+		atomic.AddInt64(&c.stats.Requests, 1)
+		start := c.clock.Now()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			c.metrics.ObserveRequest("dida", endpoint, 0, c.clock.Now().Sub(start))
+			c.log.Debug("滴答清单请求失败", "method", method, "path", path, "error", err)
+			return err
+		}
+		latency := c.clock.Now().Sub(start)
+		c.metrics.ObserveRequest("dida", endpoint, resp.StatusCode, latency)
+		c.log.Debug("滴答清单请求", "method", method, "path", path,
+			"status", resp.StatusCode, "latency_ms", latency.Milliseconds())
+
+		if shouldRetry(resp.StatusCode) && attempt < maxRetries {
+			wait := retryDelay(resp, attempt)
+			resp.Body.Close()
+			atomic.AddInt64(&c.stats.Retries, 1)
+			c.metrics.ObserveRetry("dida")
+			c.log.Warn(fmt.Sprintf("滴答清单 API 返回 %s，%v 后重试", resp.Status, wait),
+				"method", method, "path", path, "status", resp.StatusCode, "attempt", attempt+1)
+			if err := c.clock.Sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API error: %s", resp.Status)
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+
+		if result != nil {
+			return json.NewDecoder(resp.Body).Decode(result)
+		}
+		return nil
 	}
+}
+
+// shouldRetry 判断该状态码是否值得重试
+func shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
 
-	if result != nil {
-		return json.NewDecoder(resp.Body).Decode(result)
+// retryDelay 计算重试等待时间，优先使用 Retry-After 头
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
 	}
-	return nil
+	return time.Duration(1<<uint(attempt)) * 500 * time.Millisecond
 }
 
 // GetProjects 获取所有项目/清单
 func (c *Client) GetProjects(ctx context.Context) ([]Project, error) {
 	var projects []Project
-	if err := c.doRequest(ctx, "GET", "/project", &projects); err != nil {
+	if err := c.doRequest(ctx, "GET", "/project", nil, &projects); err != nil {
 		return nil, err
 	}
 	return projects, nil
@@ -71,97 +210,218 @@ func (c *Client) GetProjectTasks(ctx context.Context, projectID string) ([]Task,
 		Tasks []Task `json:"tasks"`
 	}
 	path := fmt.Sprintf("/project/%s/data", projectID)
-	if err := c.doRequest(ctx, "GET", path, &response); err != nil {
+	if err := c.doRequest(ctx, "GET", path, nil, &response); err != nil {
 		return nil, err
 	}
 	return response.Tasks, nil
 }
 
-// GetAllTasks 获取所有项目的所有任务（包括收件箱和缺失的子任务）
+// GetAllTasks 获取项目列表和所有项目的所有任务（包括收件箱和缺失的子任务），见 GetTasks
 func (c *Client) GetAllTasks(ctx context.Context) ([]Task, error) {
 	projects, err := c.GetProjects(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return c.GetTasks(ctx, projects)
+}
 
-	var allTasks []Task
+// GetTasks 获取收件箱和 projects 中所有项目的任务，并补充获取缺失的子任务。
+// 项目并发获取，并发数见 WithConcurrency。部分项目或子任务获取失败时返回成功获取的任务和 *PartialError；
+// token 无效（401）或 ctx 取消时直接返回错误
+func (c *Client) GetTasks(ctx context.Context, projects []Project) ([]Task, error) {
+	projectIDs := []string{"inbox"}
+	for _, p := range projects {
+		projectIDs = append(projectIDs, p.ID)
+	}
 
-	// 先尝试获取收件箱的任务
-	inboxTasks, err := c.GetProjectTasks(ctx, "inbox")
-	if err == nil {
-		allTasks = append(allTasks, inboxTasks...)
+	// 按项目顺序保存结果，保证任务顺序稳定
+	results := make([][]Task, len(projectIDs))
+	errs := make([]error, len(projectIDs))
+	c.parallel(len(projectIDs), func(i int) {
+		results[i], errs[i] = c.GetProjectTasks(ctx, projectIDs[i])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// 获取其他项目的任务
-	for _, p := range projects {
-		tasks, err := c.GetProjectTasks(ctx, p.ID)
-		if err != nil {
-			fmt.Printf("获取项目 %s 失败: %v\n", p.Name, err)
+	var allTasks []Task
+	var failures []*FetchError
+	for i, projectID := range projectIDs {
+		if errs[i] != nil {
+			if IsUnauthorized(errs[i]) {
+				return nil, errs[i]
+			}
+			c.log.Warn(fmt.Sprintf("获取项目 %s 失败", projectID), "project", projectID, "error", errs[i])
+			failures = append(failures, &FetchError{ProjectID: projectID, Err: errs[i]})
 			continue
 		}
-		allTasks = append(allTasks, tasks...)
+		allTasks = append(allTasks, results[i]...)
 	}
 
 	// 补充获取缺失的子任务
-	allTasks, err = c.fetchMissingSubtasks(ctx, allTasks)
-	if err != nil {
-		fmt.Printf("获取缺失子任务失败: %v\n", err)
+	allTasks, subtaskFailures := c.fetchMissingSubtasks(ctx, allTasks, projectIDs)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	for _, f := range subtaskFailures {
+		if IsUnauthorized(f.Err) {
+			return nil, f.Err
+		}
+	}
+	failures = append(failures, subtaskFailures...)
 
+	if len(failures) > 0 {
+		return allTasks, &PartialError{Errors: failures}
+	}
 	return allTasks, nil
 }
 
-// fetchMissingSubtasks 补充获取缺失的子任务
-func (c *Client) fetchMissingSubtasks(ctx context.Context, tasks []Task) ([]Task, error) {
-	// 构建已有任务的 ID 集合
-	existingIDs := make(map[string]bool)
-	for _, task := range tasks {
-		existingIDs[task.ID] = true
+// parallel 对 0 到 n-1 并发调用 fn，最多同时运行 c.concurrency 个，全部完成后返回
+func (c *Client) parallel(n int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < c.concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
 	}
-
-	// 收集所有缺失的子任务 ID 及其父任务信息
-	type missingInfo struct {
-		childID   string
-		projectID string
+	for i := 0; i < n; i++ {
+		jobs <- i
 	}
-	var missingTasks []missingInfo
+	close(jobs)
+	wg.Wait()
+}
 
+// missingSubtask 父任务 childIds 中有、但还没有获取到的子任务
+type missingSubtask struct {
+	id        string
+	projectID string // 父任务所在的项目，子任务通常在同一项目中
+}
+
+// fetchMissingSubtasks 补充获取缺失的子任务。逐层获取，新获取的子任务的子任务也会检查，
+// 直到没有缺失的子任务；每个任务只获取一次（防止父子关系成环），最多获取 maxSubtaskDepth 层。
+// 同一层的子任务并发获取。子任务不在父任务的项目中时，依次在 projectIDs 的其他项目中查找。
+// 返回获取到的全部任务和获取失败的子任务
+func (c *Client) fetchMissingSubtasks(ctx context.Context, tasks []Task, projectIDs []string) ([]Task, []*FetchError) {
+	hints := &projectHints{m: make(map[string]string)}
+	// 已获取或已尝试获取的任务 ID
+	seen := make(map[string]bool)
 	for _, task := range tasks {
-		for _, childID := range task.ChildIDs {
-			if !existingIDs[childID] {
-				missingTasks = append(missingTasks, missingInfo{
-					childID:   childID,
-					projectID: task.ProjectID,
-				})
+		seen[task.ID] = true
+	}
+
+	var failures []*FetchError
+	level := tasks
+	for depth := 0; ; depth++ {
+		// 收集本层缺失的子任务
+		var missing []missingSubtask
+		for _, task := range level {
+			for _, childID := range task.ChildIDs {
+				if !seen[childID] {
+					seen[childID] = true
+					missing = append(missing, missingSubtask{id: childID, projectID: task.ProjectID})
+				}
 			}
 		}
-	}
+		if len(missing) == 0 {
+			return tasks, failures
+		}
+		if depth >= maxSubtaskDepth {
+			c.log.Warn(fmt.Sprintf("%v，%d 个子任务未获取", errSubtaskDepth, len(missing)))
+			for _, m := range missing {
+				failures = append(failures, &FetchError{ProjectID: m.projectID, TaskID: m.id, Err: errSubtaskDepth})
+			}
+			return tasks, failures
+		}
 
-	if len(missingTasks) == 0 {
-		return tasks, nil
+		c.log.Infof("发现 %d 个缺失的子任务，正在补充获取...", len(missing))
+		fetched := make([]*Task, len(missing))
+		errs := make([]error, len(missing))
+		c.parallel(len(missing), func(i int) {
+			fetched[i], errs[i] = c.fetchSubtask(ctx, missing[i], projectIDs, hints)
+		})
+
+		level = nil
+		for i, m := range missing {
+			if errs[i] != nil {
+				c.log.Warn(fmt.Sprintf("获取子任务 %s 失败", m.id),
+					"task_id", m.id, "project", m.projectID, "error", errs[i])
+				failures = append(failures, &FetchError{ProjectID: m.projectID, TaskID: m.id, Err: errs[i]})
+				continue
+			}
+			level = append(level, *fetched[i])
+		}
+		tasks = append(tasks, level...)
+		if ctx.Err() != nil {
+			return tasks, failures
+		}
 	}
+}
 
-	fmt.Printf("发现 %d 个缺失的子任务，正在补充获取...\n", len(missingTasks))
+// projectHints 父任务所在项目 -> 上次在其他项目中找到其子任务的项目。
+// 子任务被移到其他项目时，同一批的兄弟任务通常也在那里，先查该项目可以避免逐个项目查找
+type projectHints struct {
+	mu sync.Mutex
+	m  map[string]string
+}
 
-	// 逐个获取缺失的子任务
-	for _, missing := range missingTasks {
-		task, err := c.GetTask(ctx, missing.projectID, missing.childID)
-		if err != nil {
-			fmt.Printf("获取子任务 %s 失败: %v\n", missing.childID, err)
-			continue
+func (h *projectHints) get(projectID string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.m[projectID]
+}
+
+func (h *projectHints) set(projectID, found string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.m[projectID] = found
+}
+
+// fetchSubtask 获取单个子任务：先在父任务的项目中查找，再查同一项目的子任务上次被找到的项目，
+// 都找不到时依次在其他项目中查找，找到即停止
+func (c *Client) fetchSubtask(ctx context.Context, missing missingSubtask, projectIDs []string, hints *projectHints) (*Task, error) {
+	task, err := c.GetTask(ctx, missing.projectID, missing.id)
+	if !isNotFound(err) {
+		return task, err
+	}
+
+	hint := hints.get(missing.projectID)
+	candidates := make([]string, 0, len(projectIDs))
+	if hint != "" {
+		candidates = append(candidates, hint)
+	}
+	for _, projectID := range projectIDs {
+		if projectID != missing.projectID && projectID != hint {
+			candidates = append(candidates, projectID)
 		}
-		tasks = append(tasks, *task)
-		existingIDs[task.ID] = true
 	}
+	for _, projectID := range candidates {
+		task, err = c.GetTask(ctx, projectID, missing.id)
+		if err == nil {
+			hints.set(missing.projectID, projectID)
+		}
+		if !isNotFound(err) {
+			break
+		}
+	}
+	return task, err
+}
 
-	return tasks, nil
+// isNotFound 判断错误是否为 404
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
 }
 
 // GetTask 获取单个任务
 func (c *Client) GetTask(ctx context.Context, projectID, taskID string) (*Task, error) {
 	var task Task
 	path := fmt.Sprintf("/project/%s/task/%s", projectID, taskID)
-	if err := c.doRequest(ctx, "GET", path, &task); err != nil {
+	if err := c.doRequest(ctx, "GET", path, nil, &task); err != nil {
 		return nil, err
 	}
 	return &task, nil
@@ -184,7 +444,7 @@ func (c *Client) UpdateTaskStatus(ctx context.Context, projectID, taskID string,
 	}
 
 	path := fmt.Sprintf("/project/%s/batch/task", projectID)
-	return c.doRequest(ctx, "POST", path, &updatePayload)
+	return c.doRequest(ctx, "POST", path, updatePayload, nil)
 }
 
 // UpdateTask 更新任务详情
@@ -197,5 +457,5 @@ func (c *Client) UpdateTask(ctx context.Context, projectID string, task Task) er
 	}
 
 	path := fmt.Sprintf("/project/%s/batch/task", projectID)
-	return c.doRequest(ctx, "POST", path, &updatePayload)
+	return c.doRequest(ctx, "POST", path, updatePayload, nil)
 }
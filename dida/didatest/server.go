@@ -0,0 +1,385 @@
+// Package didatest 提供内存中的滴答清单开放 API 假服务器，用于端到端测试。
+//
+// 实现了客户端用到的接口：项目列表、项目数据、单个任务、批量更新任务和 OAuth token。
+// 与真实 API 一致，项目数据只返回未完成的任务；HideFromProjectData 可以模拟
+// 子任务只出现在父任务 childIds 中、不在项目数据里的情况
+package didatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/internal/fault"
+)
+
+// AccessToken 假服务器接受的 access token
+const AccessToken = "didatest-access-token"
+
+// apiPrefix 开放 API 的路径前缀
+const apiPrefix = "/open/v1"
+
+// Server 滴答清单假服务器
+type Server struct {
+	// URL 服务器根地址，API 地址为 URL + "/open/v1"
+	URL string
+
+	srv    *httptest.Server
+	faults fault.Injector
+
+	mu       sync.Mutex
+	projects []dida.Project
+	tasks    map[string]*dida.Task
+	order    []string // 任务按添加顺序返回
+	hidden   map[string]bool
+	requests []string
+}
+
+// NewServer 启动假服务器，用完后调用 Close
+func NewServer() *Server {
+	s := &Server{
+		tasks:  make(map[string]*dida.Task),
+		hidden: make(map[string]bool),
+	}
+	s.srv = httptest.NewServer(s.faults.Wrap(http.HandlerFunc(s.handle)))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close 关闭服务器
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Endpoints 指向假服务器的地址
+func (s *Server) Endpoints() dida.Endpoints {
+	return dida.Endpoints{
+		APIBaseURL: s.URL + apiPrefix,
+		AuthURL:    s.URL + "/oauth/authorize",
+		TokenURL:   s.URL + "/oauth/token",
+	}
+}
+
+// NewOAuth 创建指向假服务器、已持有有效 token 的 OAuth 客户端
+func (s *Server) NewOAuth() *dida.OAuth {
+	oauth := dida.NewOAuth("didatest-client", "didatest-secret", "")
+	oauth.Endpoints = s.Endpoints()
+	oauth.SetToken(&dida.TokenResponse{
+		AccessToken:  AccessToken,
+		TokenType:    "bearer",
+		RefreshToken: "didatest-refresh-token",
+	})
+	return oauth
+}
+
+// NewClient 创建指向假服务器的 API 客户端
+func (s *Server) NewClient(opts ...dida.Option) *dida.Client {
+	return dida.NewClient(s.NewOAuth(), opts...)
+}
+
+// InjectFault 添加故障规则，Path 为相对于服务器根地址的路径前缀（如 /open/v1/project）
+func (s *Server) InjectFault(f fault.Fault) {
+	s.faults.Add(f)
+}
+
+// ResetFaults 清除所有故障规则
+func (s *Server) ResetFaults() {
+	s.faults.Reset()
+}
+
+// AddProject 添加项目
+func (s *Server) AddProject(p dida.Project) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.projects = append(s.projects, p)
+}
+
+// AddTask 添加或替换任务；ProjectID 为 "inbox" 的任务属于收件箱。
+// 设置了 ParentID 的任务会自动加入父任务的 ChildIDs
+func (s *Server) AddTask(t dida.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.tasks[t.ID]; !ok {
+		s.order = append(s.order, t.ID)
+	} else if parent, ok := s.tasks[old.ParentID]; ok && old.ParentID != t.ParentID {
+		// 移到其他父任务下（或不再是子任务）
+		parent.ChildIDs = remove(parent.ChildIDs, t.ID)
+	}
+	task := t
+	s.tasks[t.ID] = &task
+
+	if parent, ok := s.tasks[t.ParentID]; ok && !contains(parent.ChildIDs, t.ID) {
+		parent.ChildIDs = append(parent.ChildIDs, t.ID)
+	}
+	for _, id := range s.order {
+		if child := s.tasks[id]; child.ParentID == t.ID && !contains(task.ChildIDs, id) {
+			task.ChildIDs = append(task.ChildIDs, id)
+		}
+	}
+}
+
+// HideFromProjectData 让任务不出现在项目数据中，只能通过单个任务接口获取
+func (s *Server) HideFromProjectData(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hidden[taskID] = true
+}
+
+// CompleteTask 将任务标记为已完成
+func (s *Server) CompleteTask(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tasks[taskID]; ok {
+		t.Status = 2
+	}
+}
+
+// DeleteTask 删除任务
+func (s *Server) DeleteTask(taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteTask(taskID)
+}
+
+// Task 返回任务的当前状态
+func (s *Server) Task(taskID string) (dida.Task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return dida.Task{}, false
+	}
+	return *t, true
+}
+
+// Requests 返回收到的请求，格式为 "GET /open/v1/project"（不含被故障规则拦截的请求）
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+
+	if r.URL.Path == "/oauth/token" {
+		s.handleToken(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		writeError(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiPrefix+"/"), "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "project":
+		s.handleProjects(w)
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "project" && parts[2] == "data":
+		s.handleProjectData(w, parts[1])
+	case r.Method == "GET" && len(parts) == 4 && parts[0] == "project" && parts[2] == "task":
+		s.handleTask(w, parts[1], parts[3])
+	case r.Method == "POST" && len(parts) == 4 && parts[0] == "project" && parts[2] == "batch" && parts[3] == "task":
+		s.handleBatch(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code", "refresh_token":
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported grant_type")
+		return
+	}
+	writeJSON(w, dida.TokenResponse{
+		AccessToken:  AccessToken,
+		TokenType:    "bearer",
+		ExpiresIn:    15552000,
+		Scope:        "tasks:read tasks:write",
+		RefreshToken: "didatest-refresh-token",
+	})
+}
+
+func (s *Server) handleProjects(w http.ResponseWriter) {
+	s.mu.Lock()
+	projects := append([]dida.Project{}, s.projects...)
+	s.mu.Unlock()
+	writeJSON(w, projects)
+}
+
+func (s *Server) handleProjectData(w http.ResponseWriter, projectID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var project *dida.Project
+	for i := range s.projects {
+		if s.projects[i].ID == projectID {
+			project = &s.projects[i]
+		}
+	}
+	if project == nil && projectID != "inbox" {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	tasks := []dida.Task{}
+	for _, id := range s.order {
+		t := s.tasks[id]
+		if t.ProjectID != projectID || t.Status != 0 || s.hidden[id] {
+			continue
+		}
+		tasks = append(tasks, *t)
+	}
+
+	resp := map[string]interface{}{"tasks": tasks, "columns": []interface{}{}}
+	if project != nil {
+		resp["project"] = project
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleTask(w http.ResponseWriter, projectID, taskID string) {
+	s.mu.Lock()
+	t, ok := s.tasks[taskID]
+	var task dida.Task
+	if ok {
+		task = *t
+	}
+	s.mu.Unlock()
+
+	if !ok || task.ProjectID != projectID {
+		writeError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	writeJSON(w, task)
+}
+
+// handleBatch 批量添加、更新和删除任务；更新只覆盖请求中的非零字段
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Add    []dida.Task `json:"add"`
+		Update []dida.Task `json:"update"`
+		Delete []struct {
+			TaskID string `json:"taskId"`
+		} `json:"delete"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range payload.Update {
+		if _, ok := s.tasks[u.ID]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("task %s not found", u.ID))
+			return
+		}
+	}
+
+	id2etag := map[string]string{}
+	for _, t := range payload.Add {
+		task := t
+		if _, ok := s.tasks[t.ID]; !ok {
+			s.order = append(s.order, t.ID)
+		}
+		s.tasks[t.ID] = &task
+		id2etag[t.ID] = "etag"
+	}
+	for _, u := range payload.Update {
+		mergeTask(s.tasks[u.ID], u)
+		id2etag[u.ID] = "etag"
+	}
+	for _, d := range payload.Delete {
+		s.deleteTask(d.TaskID)
+	}
+	writeJSON(w, map[string]interface{}{"id2etag": id2etag, "id2error": map[string]string{}})
+}
+
+// mergeTask 用 u 中的非零字段覆盖 t；状态总是覆盖
+func mergeTask(t *dida.Task, u dida.Task) {
+	t.Status = u.Status
+	if u.Title != "" {
+		t.Title = u.Title
+	}
+	if u.Content != "" {
+		t.Content = u.Content
+	}
+	if u.Priority != 0 {
+		t.Priority = u.Priority
+	}
+	if u.DueDate != "" {
+		t.DueDate = u.DueDate
+	}
+	if u.StartDate != "" {
+		t.StartDate = u.StartDate
+	}
+	if u.Tags != nil {
+		t.Tags = u.Tags
+	}
+	if u.Items != nil {
+		t.Items = u.Items
+	}
+}
+
+func (s *Server) deleteTask(taskID string) {
+	delete(s.tasks, taskID)
+	for i, id := range s.order {
+		if id == taskID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// remove 返回去掉 id 后的列表
+func remove(ids []string, id string) []string {
+	var out []string
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errorCode": status, "errorMessage": msg})
+}
@@ -0,0 +1,55 @@
+package dida
+
+import "fmt"
+
+// errSubtaskDepth 子任务层级超过 maxSubtaskDepth，未继续获取
+var errSubtaskDepth = fmt.Errorf("子任务层级超过 %d 层", maxSubtaskDepth)
+
+// FetchError 获取一个项目的任务或一个缺失的子任务失败
+type FetchError struct {
+	ProjectID string // 项目 ID，收件箱为 "inbox"
+	TaskID    string // 补充获取子任务失败时为子任务 ID，否则为空
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	if e.TaskID != "" {
+		return fmt.Sprintf("获取子任务 %s 失败: %v", e.TaskID, e.Err)
+	}
+	return fmt.Sprintf("获取项目 %s 失败: %v", e.ProjectID, e.Err)
+}
+
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// PartialError 部分项目或子任务获取失败。与之一起返回的任务列表只包含获取成功的任务，
+// 调用方据此决定能否使用这份不完整的数据（如判断哪些任务已被删除）
+type PartialError struct {
+	Errors []*FetchError
+}
+
+func (e *PartialError) Error() string {
+	projects, tasks := len(e.FailedProjects()), len(e.FailedTasks())
+	return fmt.Sprintf("%d 个项目、%d 个子任务获取失败（%v）", projects, tasks, e.Errors[0])
+}
+
+// FailedProjects 获取失败的项目 ID
+func (e *PartialError) FailedProjects() []string {
+	var ids []string
+	for _, err := range e.Errors {
+		if err.TaskID == "" {
+			ids = append(ids, err.ProjectID)
+		}
+	}
+	return ids
+}
+
+// FailedTasks 获取失败的子任务 ID
+func (e *PartialError) FailedTasks() []string {
+	var ids []string
+	for _, err := range e.Errors {
+		if err.TaskID != "" {
+			ids = append(ids, err.TaskID)
+		}
+	}
+	return ids
+}
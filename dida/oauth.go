@@ -2,6 +2,7 @@ package dida
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,28 +10,85 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-)
-
-const (
-	authURL  = "https://dida365.com/oauth/authorize"
-	tokenURL = "https://dida365.com/oauth/token"
+	"sync"
+	"time"
 )
 
 type OAuth struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
-	token        *TokenResponse
+
+	// Endpoints 服务地址，默认为 Dida365；NewClient 从这里取 API 地址
+	Endpoints Endpoints
+
+	// HTTPClient 请求 token 端点使用的 HTTP 客户端，为空时使用 http.DefaultClient；
+	// 未设置时 NewClient 会改为与 API 请求相同的客户端（包括超时）
+	HTTPClient *http.Client
+	// UserAgent 请求 token 端点的 User-Agent，未设置时 NewClient 会改为 API 请求使用的值
+	UserAgent string
+
+	mu    sync.RWMutex
+	token *TokenResponse
+	sinks []TokenSink
 }
 
 func NewOAuth(clientID, clientSecret, redirectURL string) *OAuth {
+	if redirectURL == "" {
+		redirectURL = defaultRedirectURL
+	}
 	return &OAuth{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
+		Endpoints:    Dida365,
+	}
+}
+
+// GenerateState 生成随机的 state 参数，用于在回调时校验请求确实由本次授权发起
+func GenerateState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CallbackParams 授权回调 URL 中携带的参数
+type CallbackParams struct {
+	Code             string
+	State            string
+	Error            string
+	ErrorDescription string
+}
+
+// ParseCallbackParams 从回调 URL 的查询参数中提取授权结果
+func ParseCallbackParams(query url.Values) CallbackParams {
+	return CallbackParams{
+		Code:             query.Get("code"),
+		State:            query.Get("state"),
+		Error:            query.Get("error"),
+		ErrorDescription: query.Get("error_description"),
 	}
 }
 
+// Validate 检查回调是否成功且 state 与预期一致，成功时返回授权码
+func (p CallbackParams) Validate(expectedState string) (string, error) {
+	if p.Error != "" {
+		if p.ErrorDescription != "" {
+			return "", fmt.Errorf("authorization denied: %s (%s)", p.Error, p.ErrorDescription)
+		}
+		return "", fmt.Errorf("authorization denied: %s", p.Error)
+	}
+	if p.State != expectedState {
+		return "", errStateMismatch
+	}
+	if p.Code == "" {
+		return "", fmt.Errorf("no code in callback")
+	}
+	return p.Code, nil
+}
+
 // GetAuthURL 获取授权 URL，用户需要在浏览器中打开此 URL 进行授权
 func (o *OAuth) GetAuthURL(state string) string {
 	params := url.Values{}
@@ -39,7 +97,7 @@ func (o *OAuth) GetAuthURL(state string) string {
 	params.Set("response_type", "code")
 	params.Set("scope", "tasks:read tasks:write")
 	params.Set("state", state)
-	return fmt.Sprintf("%s?%s", authURL, params.Encode())
+	return fmt.Sprintf("%s?%s", o.Endpoints.AuthURL, params.Encode())
 }
 
 // ExchangeToken 用授权码换取 access token
@@ -49,8 +107,65 @@ func (o *OAuth) ExchangeToken(ctx context.Context, code string) (*TokenResponse,
 	data.Set("grant_type", "authorization_code")
 	data.Set("redirect_uri", o.RedirectURL)
 	data.Set("scope", "tasks:read tasks:write")
+	return o.requestToken(ctx, data)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+// RefreshToken 使用 refresh token 获取新的 access token 并写入已注册的 sink；
+// 只有 sink 写入失败时返回新 token 和 *SinkError，此时新 token 已生效
+func (o *OAuth) RefreshToken(ctx context.Context) (*TokenResponse, error) {
+	current := o.GetToken()
+	if current == nil || current.RefreshToken == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", current.RefreshToken)
+	data.Set("scope", "tasks:read tasks:write")
+
+	token, err := o.requestToken(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	// 部分实现刷新时不返回新的 refresh token，沿用旧的
+	if token.RefreshToken == "" {
+		token.RefreshToken = current.RefreshToken
+	}
+
+	if err := o.putSinks(ctx, token); err != nil {
+		return token, err
+	}
+	return token, nil
+}
+
+// AddSink 注册 token sink，RefreshToken 成功后写入刷新后的 token
+func (o *OAuth) AddSink(sink TokenSink) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sinks = append(o.sinks, sink)
+}
+
+// putSinks 将 token 写入所有 sink，失败时返回 *SinkError
+func (o *OAuth) putSinks(ctx context.Context, token *TokenResponse) error {
+	o.mu.RLock()
+	sinks := o.sinks
+	o.mu.RUnlock()
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Put(ctx, token); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &SinkError{Errs: errs}
+	}
+	return nil
+}
+
+// requestToken 向 token 端点请求新 token 并保存在内存中
+func (o *OAuth) requestToken(ctx context.Context, data url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", o.Endpoints.TokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -59,8 +174,15 @@ func (o *OAuth) ExchangeToken(ctx context.Context, code string) (*TokenResponse,
 	// 使用 Basic Auth 传递 client credentials
 	auth := base64.StdEncoding.EncodeToString([]byte(o.ClientID + ":" + o.ClientSecret))
 	req.Header.Set("Authorization", "Basic "+auth)
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	hc := o.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -75,80 +197,58 @@ func (o *OAuth) ExchangeToken(ctx context.Context, code string) (*TokenResponse,
 	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
 		return nil, err
 	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
 
-	o.token = &token
+	o.SetToken(&token)
 	return &token, nil
 }
 
 // GetToken 获取当前 token
 func (o *OAuth) GetToken() *TokenResponse {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
 	return o.token
 }
 
 // SetToken 设置 token（从缓存加载时使用）
 func (o *OAuth) SetToken(token *TokenResponse) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	o.token = token
 }
 
-// SaveToken 保存 token 到文件
-func (o *OAuth) SaveToken(filename string) error {
-	if o.token == nil {
+// SaveToken 保存 token 到存储
+func (o *OAuth) SaveToken(store TokenStore) error {
+	token := o.GetToken()
+	if token == nil {
 		return fmt.Errorf("no token to save")
 	}
-	data, err := json.MarshalIndent(o.token, "", "  ")
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(filename, data, 0600)
+	return store.Save(token)
 }
 
-// LoadToken 从文件加载 token
-func (o *OAuth) LoadToken(filename string) error {
-	data, err := ioutil.ReadFile(filename)
+// LoadToken 从存储加载 token
+func (o *OAuth) LoadToken(store TokenStore) error {
+	token, err := store.Load()
 	if err != nil {
 		return err
 	}
-	var token TokenResponse
-	if err := json.Unmarshal(data, &token); err != nil {
-		return err
-	}
-	o.token = &token
+	o.SetToken(token)
 	return nil
 }
 
-// StartCallbackServer 启动一个临时 HTTP 服务器来接收 OAuth 回调
-func (o *OAuth) StartCallbackServer(ctx context.Context) (string, error) {
-	codeChan := make(chan string, 1)
-	errChan := make(chan error, 1)
-
-	server := &http.Server{Addr: ":8080"}
-
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			errChan <- fmt.Errorf("no code in callback")
-			w.Write([]byte("授权失败：未收到授权码"))
-			return
-		}
-		codeChan <- code
-		w.Write([]byte("授权成功！你可以关闭此页面了。"))
-	})
-
-	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			errChan <- err
+// RefreshIfExpiring 在 token 将于 margin 内过期时刷新，返回是否进行了刷新
+func (o *OAuth) RefreshIfExpiring(ctx context.Context, margin time.Duration) (bool, error) {
+	token := o.GetToken()
+	if token == nil || !token.ExpiresWithin(margin) {
+		return false, nil
+	}
+	if _, err := o.RefreshToken(ctx); err != nil {
+		if _, ok := err.(*SinkError); ok {
+			return true, err
 		}
-	}()
-
-	select {
-	case code := <-codeChan:
-		server.Shutdown(ctx)
-		return code, nil
-	case err := <-errChan:
-		server.Shutdown(ctx)
-		return "", err
-	case <-ctx.Done():
-		server.Shutdown(ctx)
-		return "", ctx.Err()
+		return false, err
 	}
+	return true, nil
 }
@@ -0,0 +1,67 @@
+package dida_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/dida/didatest"
+)
+
+// recordingTransport 记录经过的请求
+type recordingTransport struct {
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.reqs = append(t.reqs, req)
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRefreshTokenUsesClientConfiguration(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+
+	transport := &recordingTransport{}
+	oauth := srv.NewOAuth()
+	dida.NewClient(oauth,
+		dida.WithHTTPClient(&http.Client{Transport: transport}),
+		dida.WithUserAgent("sync-test/1.0"),
+		dida.WithTimeout(5*time.Second))
+
+	if _, err := oauth.RefreshToken(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.reqs) != 1 {
+		t.Fatalf("token requests through configured client = %d, want 1", len(transport.reqs))
+	}
+	req := transport.reqs[0]
+	if req.URL.String() != oauth.Endpoints.TokenURL {
+		t.Errorf("token URL = %s, want %s", req.URL, oauth.Endpoints.TokenURL)
+	}
+	if ua := req.Header.Get("User-Agent"); ua != "sync-test/1.0" {
+		t.Errorf("User-Agent = %q", ua)
+	}
+	if oauth.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("token client timeout = %v, want 5s", oauth.HTTPClient.Timeout)
+	}
+}
+
+func TestNewClientKeepsExplicitOAuthClient(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+
+	own := &http.Client{}
+	oauth := srv.NewOAuth()
+	oauth.HTTPClient, oauth.UserAgent = own, "authorize/1.0"
+	dida.NewClient(oauth, dida.WithUserAgent("sync-test/1.0"))
+	if oauth.HTTPClient != own || oauth.UserAgent != "authorize/1.0" {
+		t.Error("NewClient replaced the OAuth client's own configuration")
+	}
+}
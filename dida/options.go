@@ -0,0 +1,93 @@
+package dida
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/metrics"
+)
+
+// Option 客户端配置项
+type Option func(*Client)
+
+// WithLogger 设置客户端使用的日志记录器
+func WithLogger(logger *logging.Logger) Option {
+	return func(c *Client) {
+		c.log = logger
+	}
+}
+
+// WithMetrics 设置客户端上报请求指标的目标
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// WithHTTPClient 设置发送请求使用的 HTTP 客户端（如指向 httptest 服务器或自定义 Transport）
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithBaseURL 设置 API 地址，覆盖默认值
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithUserAgent 设置请求的 User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout 设置单个请求的超时时间（不影响传入的 HTTP 客户端本身）
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithClock 设置重试等待和耗时统计使用的时钟
+func WithClock(clk clock.Clock) Option {
+	return func(c *Client) {
+		c.clock = clk
+	}
+}
+
+// WithRateLimiter 设置请求使用的限流器，多个客户端可以共享同一个限流器
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = l
+	}
+}
+
+// WithConcurrency 设置并发请求数的上限，同时限制 GetTasks 并发获取的项目数和补充获取子任务时的并发数，
+// 小于 1 时按 1 处理
+func WithConcurrency(n int) Option {
+	return func(c *Client) {
+		c.concurrency = n
+	}
+}
+
+// applyOptions 应用配置项；超时通过复制 HTTP 客户端设置，避免修改共享的 http.DefaultClient
+func (c *Client) applyOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.concurrency < 1 {
+		c.concurrency = 1
+	}
+	if c.timeout > 0 {
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+}
@@ -0,0 +1,48 @@
+package dida
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/clock"
+)
+
+// RateLimiter 限制请求频率：相邻两个请求至少间隔 interval。
+// 可以在多个并发请求（以及多个客户端）之间共享
+type RateLimiter struct {
+	clock    clock.Clock
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // 下一个请求最早可以发出的时间
+}
+
+// NewRateLimiter 创建每 interval 最多放行一个请求的限流器
+func NewRateLimiter(clk clock.Clock, interval time.Duration) *RateLimiter {
+	return &RateLimiter{clock: clk, interval: interval}
+}
+
+// Wait 等待到可以发出下一个请求，返回等待的时长；ctx 取消时返回 ctx.Err()。
+// l 为 nil 时不限流
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil || l.interval <= 0 {
+		return 0, ctx.Err()
+	}
+
+	// 先预留时间段再等待，并发的请求依次排队
+	l.mu.Lock()
+	now := l.clock.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := at.Sub(now)
+	if wait <= 0 {
+		return 0, ctx.Err()
+	}
+	return wait, l.clock.Sleep(ctx, wait)
+}
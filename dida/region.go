@@ -0,0 +1,55 @@
+package dida
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Endpoints 服务地址：dida365.com（国内）与 ticktick.com（国际）的 API 相同，只是域名不同
+type Endpoints struct {
+	APIBaseURL string // 开放 API 地址，如 https://api.dida365.com/open/v1
+	AuthURL    string // OAuth 授权页面
+	TokenURL   string // OAuth token 端点
+}
+
+var (
+	// Dida365 滴答清单（dida365.com）
+	Dida365 = Endpoints{
+		APIBaseURL: "https://api.dida365.com/open/v1",
+		AuthURL:    "https://dida365.com/oauth/authorize",
+		TokenURL:   "https://dida365.com/oauth/token",
+	}
+
+	// TickTick 国际版 TickTick（ticktick.com）
+	TickTick = Endpoints{
+		APIBaseURL: "https://api.ticktick.com/open/v1",
+		AuthURL:    "https://ticktick.com/oauth/authorize",
+		TokenURL:   "https://ticktick.com/oauth/token",
+	}
+)
+
+// RegionEndpoints 返回区域对应的服务地址，region 为 dida365（也可写作 dida，为空时默认）或 ticktick，不区分大小写
+func RegionEndpoints(region string) (Endpoints, error) {
+	switch strings.ToLower(region) {
+	case "", "dida365", "dida":
+		return Dida365, nil
+	case "ticktick":
+		return TickTick, nil
+	default:
+		return Endpoints{}, fmt.Errorf("unknown region %q (dida365 or ticktick)", region)
+	}
+}
+
+// Override 用非空的地址覆盖对应项，用于自定义服务地址（如本地模拟服务器）
+func (e Endpoints) Override(apiBaseURL, authURL, tokenURL string) Endpoints {
+	if apiBaseURL != "" {
+		e.APIBaseURL = strings.TrimRight(apiBaseURL, "/")
+	}
+	if authURL != "" {
+		e.AuthURL = authURL
+	}
+	if tokenURL != "" {
+		e.TokenURL = tokenURL
+	}
+	return e
+}
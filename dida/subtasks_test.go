@@ -0,0 +1,242 @@
+package dida_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/dida/didatest"
+	"dida-to-notion-sync/internal/fault"
+)
+
+func taskIDs(tasks []dida.Task) map[string]bool {
+	ids := make(map[string]bool)
+	for _, task := range tasks {
+		ids[task.ID] = true
+	}
+	return ids
+}
+
+func countTaskRequests(srv *didatest.Server) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.Contains(r, "/task/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGetAllTasksFetchesNestedSubtasks(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	srv.AddProject(dida.Project{ID: "other", Name: "其他"})
+	srv.AddTask(dida.Task{ID: "root", ProjectID: "work"})
+	srv.AddTask(dida.Task{ID: "child", ProjectID: "work", ParentID: "root"})
+	srv.AddTask(dida.Task{ID: "grandchild", ProjectID: "work", ParentID: "child"})
+	// 在其他项目中的子任务
+	srv.AddTask(dida.Task{ID: "moved", ProjectID: "other", ParentID: "child"})
+	for _, id := range []string{"child", "grandchild", "moved"} {
+		srv.HideFromProjectData(id)
+	}
+
+	tasks, err := srv.NewClient(dida.WithConcurrency(2)).GetAllTasks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := taskIDs(tasks)
+	for _, id := range []string{"root", "child", "grandchild", "moved"} {
+		if !ids[id] {
+			t.Errorf("task %s was not fetched", id)
+		}
+	}
+	if len(tasks) != 4 {
+		t.Errorf("got %d tasks, want 4", len(tasks))
+	}
+}
+
+func TestSubtasksInOtherProjectReuseFoundProject(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 10; i++ {
+		srv.AddProject(dida.Project{ID: fmt.Sprintf("p%d", i)})
+	}
+	srv.AddTask(dida.Task{ID: "root", ProjectID: "p0"})
+	// 子任务都被移到了最后一个项目
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("c%d", i)
+		srv.AddTask(dida.Task{ID: id, ProjectID: "p9", ParentID: "root"})
+		srv.HideFromProjectData(id)
+	}
+
+	// 并发为 1 时按顺序获取：第一个子任务逐个项目查找，其余先查已找到的项目
+	before := len(srv.Requests())
+	tasks, err := srv.NewClient(dida.WithConcurrency(1)).GetAllTasks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 4 {
+		t.Fatalf("got %d tasks, want 4", len(tasks))
+	}
+	lookups := 0
+	for _, r := range srv.Requests()[before:] {
+		if strings.Contains(r, "/task/") {
+			lookups++
+		}
+	}
+	// c0: p0、inbox、p1…p9 共 11 次；c1、c2: p0、p9 各 2 次
+	if lookups != 15 {
+		t.Errorf("task lookups = %d, want 15", lookups)
+	}
+}
+
+func TestGetAllTasksStopsOnSubtaskCycle(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	srv.AddTask(dida.Task{ID: "a", ProjectID: "work", ChildIDs: []string{"b"}})
+	srv.AddTask(dida.Task{ID: "b", ProjectID: "work", ChildIDs: []string{"c"}})
+	srv.AddTask(dida.Task{ID: "c", ProjectID: "work", ChildIDs: []string{"a", "b"}})
+	srv.HideFromProjectData("b")
+	srv.HideFromProjectData("c")
+
+	tasks, err := srv.NewClient().GetAllTasks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Errorf("got %d tasks, want 3", len(tasks))
+	}
+	// 每个缺失的任务只获取一次
+	if n := countTaskRequests(srv); n != 2 {
+		t.Errorf("fetched %d tasks, want 2", n)
+	}
+}
+
+func TestGetAllTasksLimitsSubtaskDepth(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	srv.AddTask(dida.Task{ID: "t0", ProjectID: "work"})
+	// t1 ~ t12 逐层嵌套，都不在项目数据中
+	for i := 1; i <= 12; i++ {
+		id := fmt.Sprintf("t%d", i)
+		srv.AddTask(dida.Task{ID: id, ProjectID: "work", ParentID: fmt.Sprintf("t%d", i-1)})
+		srv.HideFromProjectData(id)
+	}
+
+	tasks, err := srv.NewClient().GetAllTasks(context.Background())
+	var partial *dida.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("err = %v, want *PartialError", err)
+	}
+	if len(tasks) != 11 {
+		t.Errorf("got %d tasks, want root and 10 levels of subtasks", len(tasks))
+	}
+	if got := partial.FailedTasks(); len(got) != 1 || got[0] != "t11" {
+		t.Errorf("failed tasks = %v, want [t11]", got)
+	}
+}
+
+func TestGetTasksReportsFailedProjects(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	projects := []dida.Project{{ID: "work", Name: "工作"}, {ID: "home", Name: "家"}}
+	for _, p := range projects {
+		srv.AddProject(p)
+	}
+	srv.AddTask(dida.Task{ID: "w1", ProjectID: "work"})
+	srv.AddTask(dida.Task{ID: "h1", ProjectID: "home"})
+	srv.AddTask(dida.Task{ID: "i1", ProjectID: "inbox"})
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/inbox/data", Status: http.StatusBadRequest})
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/home/data", Status: http.StatusForbidden})
+
+	tasks, err := srv.NewClient(dida.WithConcurrency(3)).GetTasks(context.Background(), projects)
+	var partial *dida.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("err = %v, want *PartialError", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != "w1" {
+		t.Errorf("tasks = %+v, want only w1", tasks)
+	}
+	if got := partial.FailedProjects(); len(got) != 2 || got[0] != "inbox" || got[1] != "home" {
+		t.Errorf("failed projects = %v, want [inbox home]", got)
+	}
+	// 项目列表由调用方提供，不再重复获取
+	for _, r := range srv.Requests() {
+		if r == "GET /open/v1/project" {
+			t.Error("GetTasks fetched the project list")
+		}
+	}
+}
+
+func TestGetTasksReturnsUnauthorized(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	projects := []dida.Project{{ID: "work", Name: "工作"}}
+	srv.AddProject(projects[0])
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/work/data", Status: http.StatusUnauthorized})
+
+	_, err := srv.NewClient().GetTasks(context.Background(), projects)
+	if !dida.IsUnauthorized(err) {
+		t.Errorf("err = %v, want unauthorized", err)
+	}
+}
+
+func TestRateLimiterSpacesRequests(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+	limiter := dida.NewRateLimiter(fake, 100*time.Millisecond)
+
+	ctx := context.Background()
+	var waits []time.Duration
+	for i := 0; i < 3; i++ {
+		wait, err := limiter.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waits = append(waits, wait)
+	}
+	// 第一个请求不等待，之后的请求与上一个相隔 interval
+	if waits[0] != 0 || waits[1] != 100*time.Millisecond || waits[2] != 100*time.Millisecond {
+		t.Errorf("waits = %v", waits)
+	}
+
+	fake.Advance(time.Second)
+	if wait, _ := limiter.Wait(ctx); wait != 0 {
+		t.Errorf("wait after idle = %v, want 0", wait)
+	}
+
+	var nilLimiter *dida.RateLimiter
+	if wait, err := nilLimiter.Wait(ctx); wait != 0 || err != nil {
+		t.Errorf("nil limiter = %v, %v", wait, err)
+	}
+}
+
+func TestClientWaitsForSharedRateLimiter(t *testing.T) {
+	srv := didatest.NewServer()
+	defer srv.Close()
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+
+	fake := clock.NewFake(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+	limiter := dida.NewRateLimiter(fake, 200*time.Millisecond)
+	a := srv.NewClient(dida.WithClock(fake), dida.WithRateLimiter(limiter))
+	b := srv.NewClient(dida.WithClock(fake), dida.WithRateLimiter(limiter))
+
+	ctx := context.Background()
+	if _, err := a.GetProjects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetProjects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sleeps := fake.Sleeps(); len(sleeps) != 1 || sleeps[0] != 200*time.Millisecond {
+		t.Errorf("sleeps = %v, want one 200ms wait", sleeps)
+	}
+}
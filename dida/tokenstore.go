@@ -0,0 +1,334 @@
+package dida
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrTokenNotFound 存储中没有 token
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrReadOnlyStore 存储不支持写入（如环境变量）
+	ErrReadOnlyStore = errors.New("token store is read-only")
+)
+
+// TokenStore token 持久化后端
+type TokenStore interface {
+	// Load 读取 token，不存在时返回 ErrTokenNotFound
+	Load() (*TokenResponse, error)
+	// Save 保存 token，只读存储返回 ErrReadOnlyStore
+	Save(token *TokenResponse) error
+}
+
+// TokenSink 只写的 token 目标（如 GitHub Actions secret），token 刷新后写入
+type TokenSink interface {
+	Put(ctx context.Context, token *TokenResponse) error
+}
+
+// SinkError token 已刷新并生效，但写入部分 sink 失败
+type SinkError struct {
+	Errs []error
+}
+
+func (e *SinkError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return "write refreshed token to sink: " + strings.Join(msgs, "; ")
+}
+
+// FileTokenStore 以明文 JSON 保存在本地文件中（默认的 .token）
+type FileTokenStore struct {
+	Path string
+}
+
+func (s FileTokenStore) Load() (*TokenResponse, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeToken(data)
+}
+
+func (s FileTokenStore) Save(token *TokenResponse) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
+
+// EnvTokenStore 从环境变量读取 token JSON，只读，适用于 CI
+type EnvTokenStore struct {
+	Var string
+}
+
+func (s EnvTokenStore) Load() (*TokenResponse, error) {
+	value := strings.TrimSpace(os.Getenv(s.Var))
+	if value == "" {
+		return nil, ErrTokenNotFound
+	}
+	return decodeToken([]byte(value))
+}
+
+func (s EnvTokenStore) Save(token *TokenResponse) error {
+	return ErrReadOnlyStore
+}
+
+// EncryptedFileTokenStore 使用口令加密后保存在本地文件中（PBKDF2-SHA256 派生密钥，AES-256-GCM 加密）
+type EncryptedFileTokenStore struct {
+	Path       string
+	Passphrase string
+}
+
+const (
+	// pbkdf2Iterations 派生密钥的迭代次数
+	pbkdf2Iterations = 200000
+	// 读取文件时接受的迭代次数范围：过小说明文件被篡改以降低破解成本，过大会让 Load 长时间占用 CPU
+	minPBKDF2Iterations = 100000
+	maxPBKDF2Iterations = 10000000
+)
+
+// encryptedFile 加密 token 文件的格式
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (s EncryptedFileTokenStore) Load() (*TokenResponse, error) {
+	if s.Passphrase == "" {
+		return nil, errors.New("no passphrase for encrypted token file")
+	}
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f encryptedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid encrypted token file: %w", err)
+	}
+	if f.Version != 1 || f.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported encrypted token file (version %d, kdf %q)", f.Version, f.KDF)
+	}
+	if f.Iterations < minPBKDF2Iterations || f.Iterations > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("invalid encrypted token file: iteration count %d out of range %d-%d",
+			f.Iterations, minPBKDF2Iterations, maxPBKDF2Iterations)
+	}
+	if len(f.Salt) < 16 {
+		return nil, errors.New("invalid encrypted token file: salt too short")
+	}
+
+	gcm, err := newGCM(s.Passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	// 长度不对时 gcm.Open 会 panic
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted token file: bad nonce length")
+	}
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt token file: wrong passphrase or corrupted file")
+	}
+	return decodeToken(plaintext)
+}
+
+func (s EncryptedFileTokenStore) Save(token *TokenResponse) error {
+	if s.Passphrase == "" {
+		return errors.New("no passphrase for encrypted token file")
+	}
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	f := encryptedFile{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: pbkdf2Iterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.Passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, errors.New("invalid iteration count")
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CommandTokenStore 通过外部命令读写 token，类似 git 的 credential helper：
+// 读取时执行 "<Command> get"，从标准输出读取 token JSON；
+// 保存时执行 "<Command> store"，将 token JSON 写入标准输入。
+// get 没有输出时视为 token 不存在
+type CommandTokenStore struct {
+	Command string
+}
+
+func (s CommandTokenStore) Load() (*TokenResponse, error) {
+	out, err := runShell(s.Command+" get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, ErrTokenNotFound
+	}
+	return decodeToken(out)
+}
+
+func (s CommandTokenStore) Save(token *TokenResponse) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = runShell(s.Command+" store", data)
+	return err
+}
+
+// KeyringTokenStore 保存在操作系统的密钥环中：macOS 使用 security 命令（钥匙串），
+// Linux 使用 secret-tool（Secret Service，如 GNOME Keyring / KWallet）
+type KeyringTokenStore struct {
+	Service string
+	Account string
+}
+
+func (s KeyringTokenStore) Load() (*TokenResponse, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", s.Service, "-a", s.Account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", s.Service, "account", s.Account)
+	default:
+		return nil, fmt.Errorf("keyring token store is not supported on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		// 两个工具在找不到条目时都以非零状态退出且没有输出
+		if _, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(out)) == 0 {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("read keyring: %w", err)
+	}
+	return decodeToken(out)
+}
+
+func (s KeyringTokenStore) Save(token *TokenResponse) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// 命令行参数对其他用户可见（ps），因此用 security -i 从标准输入读取命令，token 以十六进制（-X）传入
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+			securityQuote(s.Service), securityQuote(s.Account), hex.EncodeToString(data)))
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label", s.Service+" ("+s.Account+")",
+			"service", s.Service, "account", s.Account)
+		cmd.Stdin = bytes.NewReader(data)
+	default:
+		return fmt.Errorf("keyring token store is not supported on %s", runtime.GOOS)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// security -i 中的命令失败时进程仍可能正常退出，只在标准错误中输出错误
+	if err := cmd.Run(); err != nil || (runtime.GOOS == "darwin" && stderr.Len() > 0) {
+		if err == nil {
+			err = errors.New("security failed")
+		}
+		return fmt.Errorf("write keyring: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// securityQuote 为 security -i 的命令行参数加上双引号
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// runShell 通过 shell 执行命令，返回标准输出
+func runShell(command string, stdin []byte) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func decodeToken(data []byte) (*TokenResponse, error) {
+	var token TokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("invalid token JSON: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("invalid token JSON: missing access_token")
+	}
+	return &token, nil
+}
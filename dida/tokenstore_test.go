@@ -0,0 +1,147 @@
+package dida_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/dida"
+)
+
+func testToken() *dida.TokenResponse {
+	return &dida.TokenResponse{
+		AccessToken:  "access",
+		TokenType:    "bearer",
+		ExpiresIn:    3600,
+		Scope:        "tasks:read tasks:write",
+		RefreshToken: "refresh",
+		Expiry:       time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func checkRoundTrip(t *testing.T, store dida.TokenStore) {
+	t.Helper()
+	want := testToken()
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *got != *want {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.enc")
+	store := dida.EncryptedFileTokenStore{Path: path, Passphrase: "correct horse"}
+
+	if _, err := store.Load(); err != dida.ErrTokenNotFound {
+		t.Fatalf("Load before Save = %v, want ErrTokenNotFound", err)
+	}
+	checkRoundTrip(t, store)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "access") || strings.Contains(string(data), "refresh") {
+		t.Errorf("token stored in plaintext: %s", data)
+	}
+
+	wrong := dida.EncryptedFileTokenStore{Path: path, Passphrase: "battery staple"}
+	if _, err := wrong.Load(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("Load with wrong passphrase = %v, want decrypt error", err)
+	}
+	if _, err := (dida.EncryptedFileTokenStore{Path: path}).Load(); err == nil {
+		t.Error("Load without passphrase succeeded")
+	}
+}
+
+func TestEncryptedFileTokenStoreRejectsTamperedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.enc")
+	store := dida.EncryptedFileTokenStore{Path: path, Passphrase: "correct horse"}
+	if err := store.Save(testToken()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value interface{}
+	}{
+		{"too few iterations", "iterations", 1},
+		{"too many iterations", "iterations", 1 << 40},
+		{"short salt", "salt", []byte{1, 2, 3}},
+		{"bad nonce", "nonce", []byte{1, 2, 3}},
+		{"unknown kdf", "kdf", "scrypt"},
+	}
+	for _, tt := range tests {
+		var f map[string]interface{}
+		if err := json.Unmarshal(data, &f); err != nil {
+			t.Fatal(err)
+		}
+		f[tt.field] = tt.value
+		tampered, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, tampered, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(); err == nil {
+			t.Errorf("%s: Load succeeded, want error", tt.name)
+		}
+	}
+}
+
+// writeHelper 写一个把 token 保存在 dir/token 中的 credential helper 脚本
+func writeHelper(t *testing.T, dir string) string {
+	t.Helper()
+	script := filepath.Join(dir, "helper.sh")
+	body := "#!/bin/sh\ncase \"$1\" in\nget) cat '" + dir + "/token' 2>/dev/null || true ;;\nstore) cat > '" + dir + "/token' ;;\nesac\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return "sh '" + script + "'"
+}
+
+func TestCommandTokenStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script needs sh")
+	}
+	store := dida.CommandTokenStore{Command: writeHelper(t, t.TempDir())}
+
+	if _, err := store.Load(); err != dida.ErrTokenNotFound {
+		t.Fatalf("Load before Save = %v, want ErrTokenNotFound", err)
+	}
+	checkRoundTrip(t, store)
+}
+
+func TestCommandTokenStoreErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script needs sh")
+	}
+	failing := dida.CommandTokenStore{Command: "echo denied >&2; exit 1; :"}
+	if _, err := failing.Load(); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Load = %v, want error with helper stderr", err)
+	}
+	if err := failing.Save(testToken()); err == nil {
+		t.Error("Save succeeded, want error")
+	}
+
+	garbage := dida.CommandTokenStore{Command: "echo not-json; :"}
+	if _, err := garbage.Load(); err == nil {
+		t.Error("Load of invalid output succeeded")
+	}
+}
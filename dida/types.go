@@ -1,6 +1,9 @@
 package dida
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Task 滴答清单任务
 type Task struct {
@@ -23,6 +26,67 @@ type Task struct {
 	CreatedTime  time.Time   `json:"createdTime"`
 }
 
+// didaTimeLayout 滴答清单 API 返回的时间格式，如 2019-11-13T03:00:00.000+0000
+const didaTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// parseDidaTime 解析 API 返回的时间，兼容 RFC3339 和不带毫秒的写法
+func parseDidaTime(value string) (time.Time, error) {
+	var lastErr error
+	for _, layout := range []string{didaTimeLayout, "2006-01-02T15:04:05-0700", time.RFC3339} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// taskFields 与 Task 字段相同但没有 JSON 方法，避免递归调用
+type taskFields Task
+
+// UnmarshalJSON 按滴答清单的时间格式解析 modifiedTime 和 createdTime
+func (t *Task) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		*taskFields
+		ModifiedTime string `json:"modifiedTime"`
+		CreatedTime  string `json:"createdTime"`
+	}
+	raw.taskFields = (*taskFields)(t)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var err error
+	if raw.ModifiedTime != "" {
+		if t.ModifiedTime, err = parseDidaTime(raw.ModifiedTime); err != nil {
+			return err
+		}
+	}
+	if raw.CreatedTime != "" {
+		if t.CreatedTime, err = parseDidaTime(raw.CreatedTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 按滴答清单的时间格式输出时间，零值时省略
+func (t Task) MarshalJSON() ([]byte, error) {
+	out := struct {
+		taskFields
+		ModifiedTime string `json:"modifiedTime,omitempty"`
+		CreatedTime  string `json:"createdTime,omitempty"`
+	}{taskFields: taskFields(t)}
+	if !t.ModifiedTime.IsZero() {
+		out.ModifiedTime = t.ModifiedTime.Format(didaTimeLayout)
+	}
+	if !t.CreatedTime.IsZero() {
+		out.CreatedTime = t.CreatedTime.Format(didaTimeLayout)
+	}
+	return json.Marshal(out)
+}
+
 // CheckItem 清单项/检查项（任务内的小项）
 type CheckItem struct {
 	ID        string `json:"id"`
@@ -53,6 +117,17 @@ type TokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	Scope        string `json:"scope"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// Expiry 根据 ExpiresIn 计算出的过期时间，不是 API 返回的字段
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+// ExpiresWithin 判断 token 是否会在 d 时间内过期，未知过期时间时返回 false
+func (t *TokenResponse) ExpiresWithin(d time.Duration) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+	return time.Until(t.Expiry) < d
 }
 
 // UserInfo 用户信息
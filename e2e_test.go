@@ -0,0 +1,847 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/dida/didatest"
+	"dida-to-notion-sync/internal/fault"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/notion/notiontest"
+	"dida-to-notion-sync/report"
+	"dida-to-notion-sync/state"
+)
+
+const (
+	testDatabaseID = "e2e-database"
+
+	// maxRetriesPerRequest 客户端对每个请求的最大重试次数
+	maxRetriesPerRequest = 3
+)
+
+// testSchema 测试数据库的属性，与 DESIGN.md 中的数据库结构一致
+var testSchema = map[string]string{
+	"名称": "title", "滴答ID": "rich_text", "状态": "status", "日期": "date", "项目": "select",
+	"标签": "select", "描述": "rich_text", "负责人": "select", "父任务": "relation", "子任务": "relation",
+}
+
+// e2e 一次端到端测试的环境：每个账号一个滴答清单假服务器，共用一个 Notion 假服务器
+type e2e struct {
+	t        *testing.T
+	clock    *clock.Fake
+	cfg      *config.Config
+	notion   *notiontest.Server
+	dida     map[string]*didatest.Server
+	sessions []*session
+
+	restore func()
+}
+
+// newE2E 创建测试环境；accounts 为空时为单账号模式
+func newE2E(t *testing.T, accounts ...string) *e2e {
+	oldLogger, oldClock := logger, syncClock
+	fake := clock.NewFake(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+	logger, syncClock = logging.Nop(), fake
+
+	env := &e2e{
+		t:      t,
+		clock:  fake,
+		cfg:    &config.Config{NotionOwnerProperty: "负责人"},
+		notion: notiontest.NewServer(),
+		dida:   make(map[string]*didatest.Server),
+		restore: func() {
+			logger, syncClock = oldLogger, oldClock
+		},
+	}
+	env.notion.SetClock(fake)
+	env.notion.SetDualRelation("父任务", "子任务")
+	env.notion.SetSchema(testDatabaseID, testSchema)
+
+	if len(accounts) == 0 {
+		accounts = []string{""}
+	}
+	for _, name := range accounts {
+		acc := config.Account{Name: name, NotionDatabaseID: testDatabaseID}
+		if name != "" {
+			acc.Owner = name
+		}
+		env.cfg.Accounts = append(env.cfg.Accounts, acc)
+
+		srv := didatest.NewServer()
+		env.dida[name] = srv
+		oauth := srv.NewOAuth()
+		env.sessions = append(env.sessions, &session{
+			cfg:     env.cfg,
+			account: acc,
+			ns:      newNamespace(acc, env.cfg.NotionOwnerProperty),
+			oauth:   oauth,
+			dida:    dida.NewClient(oauth, dida.WithClock(fake)),
+			notion:  env.notion.NewClient(testDatabaseID, notion.WithClock(fake)),
+			tasks:   &taskIndex{},
+			running: make(chan struct{}, 1),
+		})
+	}
+	return env
+}
+
+func (e *e2e) close() {
+	for _, srv := range e.dida {
+		srv.Close()
+	}
+	e.notion.Close()
+	e.restore()
+}
+
+// run 全量同步所有账号，返回报告和退出码
+func (e *e2e) run() (*report.Run, int) {
+	return e.runSince(time.Time{})
+}
+
+// runSince 同步所有账号，since 非零时为增量同步
+func (e *e2e) runSince(since time.Time) (*report.Run, int) {
+	rep := report.New()
+	err := syncAll(context.Background(), e.sessions, rep, since)
+	rep.Finish(err)
+	return rep, exitCodeFor(err, rep, e.cfg.FailureThreshold)
+}
+
+// mustRun 全量同步并要求成功
+func (e *e2e) mustRun() *report.Run {
+	e.t.Helper()
+	return e.mustRunSince(time.Time{})
+}
+
+// mustRunSince 同步并要求成功
+func (e *e2e) mustRunSince(since time.Time) *report.Run {
+	e.t.Helper()
+	rep, code := e.runSince(since)
+	if code != exitOK {
+		e.t.Fatalf("exit code = %d, failures: %+v", code, rep.Failures)
+	}
+	return rep
+}
+
+// pagesByKey 以 滴答ID 为键的 Notion 页面
+func (e *e2e) pagesByKey() map[string]notion.Page {
+	e.t.Helper()
+	pages := make(map[string]notion.Page)
+	for _, p := range e.notion.Pages(testDatabaseID) {
+		key, ok := extractDidaIDFromPage(p)
+		if !ok {
+			e.t.Fatalf("page %s has no 滴答ID", p.ID)
+		}
+		if _, dup := pages[key]; dup {
+			e.t.Fatalf("duplicate pages for 滴答ID %s", key)
+		}
+		pages[key] = p
+	}
+	return pages
+}
+
+// relationIDs 页面 relation 属性中的页面 ID（排序后）
+func relationIDs(p notion.Page, name string) []string {
+	ids := p.Relation(name)
+	sort.Strings(ids)
+	return ids
+}
+
+func pageStatus(p notion.Page) string {
+	status, _ := extractStatusFromPage(p)
+	return status
+}
+
+// seedProject 创建一个项目：父任务 parent 有两个子任务，其中 hidden 只在 childIds 中出现；
+// 另外在收件箱中放一个任务
+func seedProject(srv *didatest.Server) {
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	srv.AddTask(dida.Task{ID: "parent", ProjectID: "work", Title: "父任务", Priority: 5})
+	srv.AddTask(dida.Task{ID: "child", ProjectID: "work", ParentID: "parent", Title: "子任务",
+		DueDate: "2026-10-20T00:00:00.000+0000"})
+	srv.AddTask(dida.Task{ID: "hidden", ProjectID: "work", ParentID: "parent", Title: "隐藏的子任务"})
+	srv.HideFromProjectData("hidden")
+	srv.AddTask(dida.Task{ID: "inbox1", ProjectID: "inbox", Title: "收件箱任务",
+		ModifiedTime: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)})
+}
+
+func TestE2ECreatesPagesAndRelations(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	seedProject(env.dida[""])
+
+	rep := env.mustRun()
+	if rep.Counts.Tasks != 4 || rep.Counts.Created != 4 {
+		t.Fatalf("counts = %+v, want 4 tasks created", rep.Counts)
+	}
+
+	pages := env.pagesByKey()
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4", len(pages))
+	}
+	parent, child, hidden := pages["parent"], pages["child"], pages["hidden"]
+
+	want := []string{child.ID, hidden.ID}
+	sort.Strings(want)
+	if got := relationIDs(parent, "子任务"); !equalStringSlices(got, want) {
+		t.Errorf("parent 子任务 = %v, want %v", got, want)
+	}
+	for _, p := range []notion.Page{child, hidden} {
+		if got := relationIDs(p, "父任务"); !equalStringSlices(got, []string{parent.ID}) {
+			t.Errorf("page %s 父任务 = %v, want [%s]", p.ID, got, parent.ID)
+		}
+	}
+	if got := pageStatus(pages["inbox1"]); got != "未开始" {
+		t.Errorf("inbox task status = %q", got)
+	}
+	if project, _ := pages["inbox1"].Select("项目"); project != "收集箱" {
+		t.Errorf("inbox task 项目 = %q", project)
+	}
+	if rep.Counts.Relations != 2 {
+		t.Errorf("relations = %d, want 2", rep.Counts.Relations)
+	}
+}
+
+func TestE2ESecondRunUpdatesWithoutDuplicates(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	env.mustRun()
+
+	srv.AddTask(dida.Task{ID: "inbox1", ProjectID: "inbox", Title: "改过的标题"})
+	rep := env.mustRun()
+	if rep.Counts.Created != 0 || rep.Counts.Updated != 4 {
+		t.Fatalf("counts = %+v, want 4 updated", rep.Counts)
+	}
+
+	pages := env.pagesByKey()
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4", len(pages))
+	}
+	if title, _ := pages["inbox1"].Text("名称"); title != "改过的标题" {
+		t.Errorf("title = %q", title)
+	}
+}
+
+func TestE2ECompletionBothDirections(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	srv.AddTask(dida.Task{ID: "inbox2", ProjectID: "inbox", Title: "将被删除的任务"})
+	env.mustRun()
+
+	// 已完成的子任务仍在父任务的 childIds 中，会被补充获取并以完成状态更新
+	srv.CompleteTask("child")
+	// 滴答清单中已不存在的任务应在 Notion 中标记完成
+	srv.DeleteTask("inbox2")
+	// Notion 中标记完成的任务应同步回滴答清单；全量同步的第一轮会用滴答清单的状态覆盖页面，
+	// 所以这里用增量同步跳过未修改的 inbox1
+	pages := env.pagesByKey()
+	done := notion.Properties{"状态": notion.NewStatus("完成")}
+	if _, err := env.sessions[0].notion.UpdatePage(context.Background(), pages["inbox1"].ID, done); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := env.mustRunSince(env.clock.Now())
+	if rep.Counts.Skipped != 1 {
+		t.Errorf("skipped = %d, want 1", rep.Counts.Skipped)
+	}
+	if rep.Counts.Completed != 2 {
+		t.Errorf("completed = %d, want 2", rep.Counts.Completed)
+	}
+
+	pages = env.pagesByKey()
+	for _, key := range []string{"child", "inbox2", "inbox1"} {
+		if got := pageStatus(pages[key]); got != "完成" {
+			t.Errorf("%s page status = %q, want 完成", key, got)
+		}
+	}
+	if got := pageStatus(pages["parent"]); got != "未开始" {
+		t.Errorf("parent page status = %q", got)
+	}
+
+	task, ok := srv.Task("inbox1")
+	if !ok || task.Status != 2 {
+		t.Errorf("inbox1 status = %d, want 2", task.Status)
+	}
+	if task.Title != "收件箱任务" {
+		t.Errorf("inbox1 title = %q, status update must not clear other fields", task.Title)
+	}
+}
+
+func TestE2EPaginatesLargeDatabase(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	for i := 0; i < 120; i++ {
+		srv.AddTask(dida.Task{ID: fmt.Sprintf("task%03d", i), ProjectID: "inbox", Title: fmt.Sprintf("任务 %d", i)})
+	}
+	env.mustRun()
+
+	// 最后一页中的任务被删除，检测完成时需要翻页才能找到它
+	srv.DeleteTask("task110")
+	rep := env.mustRun()
+	if rep.Counts.Completed != 1 {
+		t.Errorf("completed = %d, want 1", rep.Counts.Completed)
+	}
+	if got := pageStatus(env.pagesByKey()["task110"]); got != "完成" {
+		t.Errorf("task110 page status = %q, want 完成", got)
+	}
+}
+
+func TestE2ERetriesRateLimits(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	seedProject(env.dida[""])
+	env.notion.InjectFault(fault.Fault{Method: "POST", Path: "/v1/pages",
+		Status: http.StatusTooManyRequests, RetryAfter: 7, Times: 2})
+	env.dida[""].InjectFault(fault.Fault{Path: "/open/v1/project/work/data",
+		Status: http.StatusBadGateway, Times: 1})
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 4 {
+		t.Fatalf("created = %d, want 4", rep.Counts.Created)
+	}
+	if got := rep.API["notion"].Retries; got != 2 {
+		t.Errorf("notion retries = %d, want 2", got)
+	}
+	if got := rep.API["dida"].Retries; got != 1 {
+		t.Errorf("dida retries = %d, want 1", got)
+	}
+
+	var retryAfter int
+	for _, d := range env.clock.Sleeps() {
+		if d == 7*time.Second {
+			retryAfter++
+		}
+	}
+	if retryAfter != 2 {
+		t.Errorf("slept for Retry-After %d times, want 2 (sleeps: %v)", retryAfter, env.clock.Sleeps())
+	}
+}
+
+func TestE2EServerErrorsSetExitCode(t *testing.T) {
+	t.Run("all creates fail", func(t *testing.T) {
+		env := newE2E(t)
+		defer env.close()
+		seedProject(env.dida[""])
+		env.notion.InjectFault(fault.Fault{Method: "POST", Path: "/v1/pages", Status: http.StatusInternalServerError})
+
+		rep, code := env.run()
+		if code != exitTotalFailure {
+			t.Errorf("exit code = %d, want %d", code, exitTotalFailure)
+		}
+		if rep.Counts.Failed != 4 {
+			t.Errorf("failed = %d, want 4", rep.Counts.Failed)
+		}
+		if got := rep.API["notion"].Retries; got != 4*maxRetriesPerRequest {
+			t.Errorf("notion retries = %d, want %d", got, 4*maxRetriesPerRequest)
+		}
+	})
+
+	t.Run("project list unavailable", func(t *testing.T) {
+		env := newE2E(t)
+		defer env.close()
+		seedProject(env.dida[""])
+		env.dida[""].InjectFault(fault.Fault{Path: "/open/v1/project", Status: http.StatusServiceUnavailable})
+
+		_, code := env.run()
+		if code != exitTotalFailure {
+			t.Errorf("exit code = %d, want %d", code, exitTotalFailure)
+		}
+		if n := len(env.notion.Requests()); n != 0 {
+			t.Errorf("sent %d Notion requests after fetch failure", n)
+		}
+	})
+
+	t.Run("completion write-back fails", func(t *testing.T) {
+		env := newE2E(t)
+		defer env.close()
+		seedProject(env.dida[""])
+		env.mustRun()
+
+		env.dida[""].DeleteTask("inbox1")
+		env.notion.InjectFault(fault.Fault{Method: "PATCH", Path: "/v1/pages/" + env.pagesByKey()["inbox1"].ID,
+			Status: http.StatusBadRequest})
+		rep, code := env.run()
+		if code != exitPartialFailure {
+			t.Errorf("exit code = %d, want %d", code, exitPartialFailure)
+		}
+		if rep.Counts.Failed != 0 || rep.Counts.CompleteFailed != 1 {
+			t.Errorf("counts = %+v, want one completion failure", rep.Counts)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		env := newE2E(t)
+		defer env.close()
+		env.sessions[0].oauth.SetToken(&dida.TokenResponse{AccessToken: "expired"})
+
+		_, code := env.run()
+		if code != exitAuthError {
+			t.Errorf("exit code = %d, want %d", code, exitAuthError)
+		}
+		if !env.sessions[0].needsRefresh {
+			t.Error("session should be marked for token refresh after 401")
+		}
+	})
+}
+
+func TestE2ESlowSubtaskFetchIsSkipped(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	env.sessions[0].dida = srv.NewClient(dida.WithClock(env.clock), dida.WithTimeout(20*time.Millisecond))
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/work/task/hidden", Latency: 500 * time.Millisecond})
+
+	rep, code := env.run()
+	if code != exitPartialFailure {
+		t.Errorf("exit code = %d, want %d", code, exitPartialFailure)
+	}
+	if rep.Counts.Tasks != 3 {
+		t.Errorf("tasks = %d, want 3 when the hidden subtask times out", rep.Counts.Tasks)
+	}
+	if _, ok := env.pagesByKey()["hidden"]; ok {
+		t.Error("hidden subtask should not be synced")
+	}
+}
+
+func TestE2EMultiAccountIsolation(t *testing.T) {
+	env := newE2E(t, "alice", "bob")
+	defer env.close()
+	for _, name := range []string{"alice", "bob"} {
+		srv := env.dida[name]
+		srv.AddProject(dida.Project{ID: "p", Name: "项目"})
+		// 两个账号使用相同的任务 ID
+		srv.AddTask(dida.Task{ID: "t1", ProjectID: "p", Title: name + " 的任务"})
+	}
+
+	env.mustRun()
+	pages := env.pagesByKey()
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2: %v", len(pages), pages)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		p, ok := pages[name+":t1"]
+		if !ok {
+			t.Fatalf("missing page for %s:t1", name)
+		}
+		if owner, _ := p.Select("负责人"); owner != name {
+			t.Errorf("%s page 负责人 = %q", name, owner)
+		}
+	}
+
+	env.dida["bob"].CompleteTask("t1")
+	rep := env.mustRun()
+	if rep.Counts.Completed != 1 {
+		t.Errorf("completed = %d, want 1", rep.Counts.Completed)
+	}
+	pages = env.pagesByKey()
+	if got := pageStatus(pages["bob:t1"]); got != "完成" {
+		t.Errorf("bob page status = %q, want 完成", got)
+	}
+	if got := pageStatus(pages["alice:t1"]); got != "未开始" {
+		t.Errorf("alice page status = %q, want 未开始", got)
+	}
+}
+
+func TestE2EMultiAccountAdoptsUnprefixedPages(t *testing.T) {
+	env := newE2E(t, "alice", "bob")
+	defer env.close()
+	old := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	env.dida["alice"].AddTask(dida.Task{ID: "t1", ProjectID: "inbox", Title: "任务一", ModifiedTime: old})
+	env.dida["bob"].AddTask(dida.Task{ID: "t2", ProjectID: "inbox", Title: "任务二", ModifiedTime: old})
+	// 切换到多账号前同步的页面，滴答ID 没有前缀
+	for _, id := range []string{"t1", "t2", "gone"} {
+		env.notion.AddPage(testDatabaseID, notion.Properties{
+			"滴答ID": notion.DidaIDProperty(id),
+			"状态":   notion.NewStatus("未开始"),
+		})
+	}
+
+	// 增量同步中任务未修改，也要改写 滴答ID
+	rep := env.mustRunSince(env.clock.Now())
+	if rep.Counts.Created != 0 || rep.Counts.Updated != 2 {
+		t.Errorf("created = %d, updated = %d, want 0 and 2", rep.Counts.Created, rep.Counts.Updated)
+	}
+	pages := env.pagesByKey()
+	for _, key := range []string{"alice:t1", "bob:t2", "gone"} {
+		if _, ok := pages[key]; !ok {
+			t.Errorf("no page for %q, got %v", key, pages)
+		}
+	}
+	// 不属于任何账号的旧页面不会被标记完成
+	if got := pageStatus(pages["gone"]); got != "未开始" {
+		t.Errorf("unprefixed page status = %q, want 未开始", got)
+	}
+	if n := len(env.notion.Pages(testDatabaseID)); n != 3 {
+		t.Errorf("got %d pages, want 3", n)
+	}
+}
+
+func TestE2ELostCreateResponseDoesNotDuplicate(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.dida[""].AddTask(dida.Task{ID: "t1", ProjectID: "inbox", Title: "任务"})
+	// 页面已创建但响应丢失，且新页面要 3 秒后才能被查询到
+	env.notion.SetQueryLag(3 * time.Second)
+	env.notion.InjectFault(fault.Fault{Method: "POST", Path: "/v1/pages",
+		Status: http.StatusGatewayTimeout, Applied: true, Times: 1})
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 1 {
+		t.Errorf("created = %d, want 1", rep.Counts.Created)
+	}
+	if pages := env.notion.Pages(testDatabaseID); len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+}
+
+func TestE2EPendingCreateIsCheckedOnNextRun(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	env.dida[""].AddTask(dida.Task{ID: "t1", ProjectID: "inbox", Title: "任务"})
+
+	// 第一次运行创建请求的结果未知
+	env.notion.InjectFault(fault.Fault{Method: "POST", Path: "/v1/pages", Status: http.StatusBadGateway})
+	if _, code := env.run(); code == exitOK {
+		t.Fatal("expected failure")
+	}
+	st, err := state.Load(env.cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.HasPendingCreate("t1", testDatabaseID) {
+		t.Fatalf("pending creates = %v", st.PendingCreates)
+	}
+
+	// 页面实际上已经创建，但还没出现在查询结果中
+	env.notion.ResetFaults()
+	env.notion.SetQueryLag(3 * time.Second)
+	env.notion.AddPage(testDatabaseID, notion.Properties{"名称": notion.NewTitle("任务"), "滴答ID": notion.DidaIDProperty("t1")})
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 0 || rep.Counts.Updated != 1 {
+		t.Errorf("counts = %+v, want 1 updated", rep.Counts)
+	}
+	if pages := env.notion.Pages(testDatabaseID); len(pages) != 1 {
+		t.Errorf("got %d pages, want 1", len(pages))
+	}
+	if st, _ := state.Load(env.cfg.StateFile); len(st.PendingCreates) != 0 {
+		t.Errorf("pending creates = %v", st.PendingCreates)
+	}
+}
+
+// TestE2EPendingCreatesKeptPerDatabase 其他数据库中同一滴答ID 的未确认创建不受影响
+func TestE2EPendingCreatesKeptPerDatabase(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	env.dida[""].AddTask(dida.Task{ID: "t1", ProjectID: "inbox", Title: "任务"})
+
+	started := env.clock.Now()
+	if err := state.Update(env.cfg.StateFile, func(st *state.State) {
+		st.PendingCreatesOf("other-database")["t1"] = started
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 1 {
+		t.Errorf("created = %d, want 1", rep.Counts.Created)
+	}
+	st, err := state.Load(env.cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.HasPendingCreate("t1", testDatabaseID) {
+		t.Error("confirmed create still pending")
+	}
+	if !st.HasPendingCreate("t1", "other-database") {
+		t.Errorf("pending creates = %v, want other-database record kept", st.PendingCreates)
+	}
+}
+
+func TestE2ERelationsOnlyWrittenWhenChanged(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	env.mustRun()
+
+	// 父任务的子任务按 ChildIDs 排列
+	pages := env.pagesByKey()
+	want := []string{pages["child"].ID, pages["hidden"].ID}
+	if got := pages["parent"].Relation("子任务"); !equalStringSlices(got, want) {
+		t.Errorf("子任务 = %v, want %v", got, want)
+	}
+
+	// 关系没有变化时不写关联：每个页面只有一次属性更新
+	before := len(env.notion.Requests())
+	rep := env.mustRun()
+	if rep.Counts.Relations != 0 {
+		t.Errorf("relations = %d, want 0", rep.Counts.Relations)
+	}
+	patches := 0
+	for _, r := range env.notion.Requests()[before:] {
+		if strings.HasPrefix(r, "PATCH /v1/pages/") {
+			patches++
+		}
+	}
+	if patches != rep.Counts.Updated {
+		t.Errorf("page PATCHes = %d, want %d (one per updated task)", patches, rep.Counts.Updated)
+	}
+
+	// 子任务移出父任务后，两边的关联都被清除
+	srv.AddTask(dida.Task{ID: "child", ProjectID: "work", Title: "子任务"})
+	rep = env.mustRun()
+	if rep.Counts.Relations != 1 {
+		t.Errorf("relations = %d, want 1", rep.Counts.Relations)
+	}
+	pages = env.pagesByKey()
+	if got := pages["child"].Relation("父任务"); len(got) != 0 {
+		t.Errorf("moved child 父任务 = %v", got)
+	}
+	if got := pages["parent"].Relation("子任务"); !equalStringSlices(got, []string{pages["hidden"].ID}) {
+		t.Errorf("parent 子任务 = %v", got)
+	}
+}
+
+func TestE2EChildOrderFollowsChildIDs(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	env.mustRun()
+
+	// 在滴答清单中调整子任务顺序，只重写父任务的 子任务 顺序
+	srv.AddTask(dida.Task{ID: "parent", ProjectID: "work", Title: "父任务", Priority: 5, ChildIDs: []string{"hidden", "child"}})
+	before := len(env.notion.Requests())
+	rep := env.mustRun()
+	pages := env.pagesByKey()
+	want := []string{pages["hidden"].ID, pages["child"].ID}
+	if got := pages["parent"].Relation("子任务"); !equalStringSlices(got, want) {
+		t.Errorf("子任务 = %v, want %v", got, want)
+	}
+	if rep.Counts.Relations != 1 {
+		t.Errorf("relations = %d, want 1", rep.Counts.Relations)
+	}
+
+	// 已有页面从一次全量查询中查找，不再逐个任务查询：同步阶段和完成检查各查询一次
+	queries := 0
+	for _, r := range env.notion.Requests()[before:] {
+		if strings.HasPrefix(r, "POST /v1/databases/") {
+			queries++
+		}
+	}
+	if queries != 2 {
+		t.Errorf("database queries = %d, want 2", queries)
+	}
+
+	// 顺序一致后不再写入
+	if rep := env.mustRun(); rep.Counts.Relations != 0 {
+		t.Errorf("relations on unchanged run = %d, want 0", rep.Counts.Relations)
+	}
+}
+
+// TestE2EDatabaseWithoutParentRelation 数据库中没有 父任务 属性时只跳过关联，任务属性照常写入
+func TestE2EDatabaseWithoutParentRelation(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	schema := make(map[string]string)
+	for name, typ := range testSchema {
+		if name != "父任务" && name != "子任务" {
+			schema[name] = typ
+		}
+	}
+	env.notion.SetSchema(testDatabaseID, schema)
+	seedProject(env.dida[""])
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 4 || rep.Counts.Failed != 0 || rep.Counts.Relations != 0 {
+		t.Fatalf("counts = %+v, want 4 created without relations", rep.Counts)
+	}
+
+	// 子任务改名后更新成功
+	env.clock.Advance(time.Hour)
+	env.dida[""].AddTask(dida.Task{ID: "child", ProjectID: "work", ParentID: "parent", Title: "改名的子任务"})
+	rep = env.mustRun()
+	if rep.Counts.Updated != 4 || rep.Counts.Failed != 0 {
+		t.Fatalf("counts = %+v, want 4 updated", rep.Counts)
+	}
+	if title, _ := env.pagesByKey()["child"].Text("名称"); title != "改名的子任务" {
+		t.Errorf("child title = %q", title)
+	}
+}
+
+func TestE2EChildrenCreatedWithParentRelation(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	// 子任务排在父任务之前，同步时仍先创建父任务
+	srv.AddTask(dida.Task{ID: "grandchild", ProjectID: "work", ParentID: "child", Title: "孙任务"})
+	srv.AddTask(dida.Task{ID: "child", ProjectID: "work", ParentID: "parent", Title: "子任务"})
+	srv.AddTask(dida.Task{ID: "parent", ProjectID: "work", Title: "父任务"})
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 3 || rep.Counts.Relations != 2 {
+		t.Fatalf("counts = %+v, want 3 created, 2 relations", rep.Counts)
+	}
+	for _, r := range env.notion.Requests() {
+		if strings.HasPrefix(r, "PATCH ") {
+			t.Errorf("first run sent %s", r)
+		}
+	}
+
+	pages := env.pagesByKey()
+	if got := pages["parent"].Relation("子任务"); !equalStringSlices(got, []string{pages["child"].ID}) {
+		t.Errorf("parent 子任务 = %v", got)
+	}
+	if got := pages["child"].Relation("子任务"); !equalStringSlices(got, []string{pages["grandchild"].ID}) {
+		t.Errorf("child 子任务 = %v", got)
+	}
+	if got := pages["grandchild"].Relation("父任务"); !equalStringSlices(got, []string{pages["child"].ID}) {
+		t.Errorf("grandchild 父任务 = %v", got)
+	}
+}
+
+func TestE2EParentCycleStillSyncs(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	srv.AddProject(dida.Project{ID: "work", Name: "工作"})
+	srv.AddTask(dida.Task{ID: "a", ProjectID: "work", ParentID: "b", Title: "A"})
+	srv.AddTask(dida.Task{ID: "b", ProjectID: "work", ParentID: "a", Title: "B"})
+
+	rep := env.mustRun()
+	if rep.Counts.Created != 2 {
+		t.Fatalf("counts = %+v, want 2 created", rep.Counts)
+	}
+}
+
+func TestE2EPartialFetchOnlyCompletesFetchedProjects(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	srv := env.dida[""]
+	seedProject(srv)
+	srv.AddTask(dida.Task{ID: "inbox2", ProjectID: "inbox", Title: "将被删除的任务"})
+	env.mustRun()
+
+	// work 项目获取失败：其中的任务不能被当作已删除，收件箱中删除的任务照常标记完成
+	srv.DeleteTask("inbox2")
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/work/data", Status: http.StatusBadRequest})
+	rep, code := env.run()
+	if code != exitPartialFailure {
+		t.Errorf("exit code = %d, want %d", code, exitPartialFailure)
+	}
+	if rep.Counts.Tasks != 1 || rep.Counts.Completed != 1 {
+		t.Errorf("counts = %+v, want 1 task and 1 completed", rep.Counts)
+	}
+	for key, page := range env.pagesByKey() {
+		want := "未开始"
+		if key == "inbox2" {
+			want = "完成"
+		}
+		if got := pageStatus(page); got != want {
+			t.Errorf("%s page status = %q, want %s", key, got, want)
+		}
+	}
+	if len(rep.Failures) != 1 || rep.Failures[0].Phase != "fetch_tasks" {
+		t.Errorf("failures = %+v, want one fetch_tasks failure", rep.Failures)
+	}
+
+	// 所有项目都获取失败时不同步
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/inbox/data", Status: http.StatusBadRequest})
+	if _, code := env.run(); code != exitTotalFailure {
+		t.Errorf("exit code = %d, want %d", code, exitTotalFailure)
+	}
+}
+
+func TestE2EPartialFetchScopeIgnoresEditedProjectProperty(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	srv := env.dida[""]
+	seedProject(srv)
+	env.mustRun()
+
+	// 页面的 项目 属性被手动改成了获取成功的项目，另有一个没有同步记录的页面
+	pages := env.pagesByKey()
+	if _, err := env.sessions[0].notion.UpdatePage(context.Background(), pages["parent"].ID,
+		notion.Properties{"项目": notion.NewSelect("收集箱")}); err != nil {
+		t.Fatal(err)
+	}
+	env.notion.AddPage(testDatabaseID, notion.Properties{
+		"滴答ID": notion.DidaIDProperty("manual"),
+		"项目":   notion.NewSelect("收集箱"),
+		"状态":   notion.NewStatus("未开始"),
+	})
+
+	// 新的进程从状态文件读取任务所在项目；work 项目获取失败，其中的任务按项目 ID 排除在外，
+	// 收件箱中删除的任务照常标记完成
+	env.sessions[0].taskProjects = nil
+	srv.DeleteTask("inbox1")
+	srv.InjectFault(fault.Fault{Path: "/open/v1/project/work/data", Status: http.StatusBadRequest})
+	rep, code := env.run()
+	if code != exitPartialFailure {
+		t.Errorf("exit code = %d, want %d", code, exitPartialFailure)
+	}
+	if rep.Counts.Completed != 1 {
+		t.Errorf("completed = %d, want 1", rep.Counts.Completed)
+	}
+	for key, page := range env.pagesByKey() {
+		want := "未开始"
+		if key == "inbox1" {
+			want = "完成"
+		}
+		if got := pageStatus(page); got != want {
+			t.Errorf("%s page status = %q, want %s", key, got, want)
+		}
+	}
+}
+
+func TestE2EMassCompletionRequiresForce(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.cfg.MaxCompleteFraction = 0.2
+	srv := env.dida[""]
+	for i := 0; i < 10; i++ {
+		srv.AddTask(dida.Task{ID: fmt.Sprintf("t%d", i), ProjectID: "inbox", Title: "任务"})
+	}
+	env.mustRun()
+
+	// 6/10 的任务从滴答清单中消失，超过 20%
+	for i := 0; i < 6; i++ {
+		srv.DeleteTask(fmt.Sprintf("t%d", i))
+	}
+	rep, code := env.run()
+	if code != exitSafetyAbort {
+		t.Fatalf("exit code = %d, want %d", code, exitSafetyAbort)
+	}
+	if rep.Counts.Completed != 0 {
+		t.Errorf("completed = %d, want 0", rep.Counts.Completed)
+	}
+	for key, page := range env.pagesByKey() {
+		if got := pageStatus(page); got != "未开始" {
+			t.Errorf("%s page status = %q after aborted run", key, got)
+		}
+	}
+
+	env.cfg.Force = true
+	if rep := env.mustRun(); rep.Counts.Completed != 6 {
+		t.Errorf("completed with -force = %d, want 6", rep.Counts.Completed)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/report"
+)
+
+// 进程退出码，供 CI 区分失败类型
+const (
+	exitOK             = 0
+	exitError          = 1 // 未分类的错误
+	exitConfigError    = 2 // 配置缺失或无效
+	exitAuthError      = 3 // 授权失败或 token 无效
+	exitPartialFailure = 4 // 部分任务失败且超过阈值
+	exitTotalFailure   = 5 // 所有任务失败，或无法获取数据
+	exitSafetyAbort    = 6 // 将要批量标记完成的页面过多，需要 -force 确认
+)
+
+// maxSummaryFailures stderr 摘要中最多列出的失败任务数
+const maxSummaryFailures = 20
+
+// codedError 携带退出码的错误
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode 为错误附加退出码
+func withCode(code int, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// exitCodeFor 根据运行错误和失败统计决定退出码
+func exitCodeFor(err error, rep *report.Run, threshold config.FailureThreshold) int {
+	if err != nil {
+		var coded *codedError
+		if errors.As(err, &coded) {
+			return coded.code
+		}
+		if dida.IsUnauthorized(err) || notion.IsUnauthorized(err) {
+			return exitAuthError
+		}
+		return exitError
+	}
+
+	failed := rep.Counts.Failed
+	attempted := rep.Counts.Created + rep.Counts.Updated + rep.Counts.Skipped + failed
+	if failed > 0 && failed == attempted {
+		return exitTotalFailure
+	}
+	// 关联和完成状态的写入失败与任务同步失败一样计入阈值
+	if threshold.Exceeded(failedWrites(rep.Counts), rep.Counts.Tasks) {
+		return exitPartialFailure
+	}
+	return exitOK
+}
+
+// failedWrites 本次运行中失败的写入：任务同步、单独写入的关联和完成状态
+func failedWrites(c report.Counts) int {
+	return c.Failed + c.RelationsFailed + c.CompleteFailed
+}
+
+// printErrorSummary 在 stderr 输出错误摘要
+func printErrorSummary(w io.Writer, err error, rep *report.Run, code int) {
+	if code == exitOK {
+		return
+	}
+
+	fmt.Fprintf(w, "\n同步失败 (退出码 %d)\n", code)
+	if err != nil {
+		fmt.Fprintf(w, "  错误: %v\n", err)
+	}
+	if rep.Counts.Tasks > 0 {
+		fmt.Fprintf(w, "  失败任务: %d/%d\n", rep.Counts.Failed, rep.Counts.Tasks)
+	}
+	if n := rep.Counts.RelationsFailed + rep.Counts.CompleteFailed; n > 0 {
+		fmt.Fprintf(w, "  关联或完成状态写入失败: %d\n", n)
+	}
+	for i, f := range rep.Failures {
+		if i == maxSummaryFailures {
+			fmt.Fprintf(w, "  ... 另有 %d 条失败记录，详见运行报告\n", len(rep.Failures)-maxSummaryFailures)
+			break
+		}
+		fmt.Fprintf(w, "  [%s] %s %s: %s\n", f.Phase, f.DidaID, f.Title, f.Error)
+	}
+}
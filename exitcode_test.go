@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/report"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		counts    report.Counts
+		threshold config.FailureThreshold
+		want      int
+	}{
+		{name: "success", counts: report.Counts{Tasks: 3, Created: 1, Updated: 1, Skipped: 1}, want: exitOK},
+		{name: "no tasks", want: exitOK},
+		{name: "unclassified error", err: errors.New("boom"), want: exitError},
+		{name: "config error", err: withCode(exitConfigError, errors.New("missing")), want: exitConfigError},
+		{name: "dida unauthorized", err: fmt.Errorf("获取项目失败: %w", &dida.APIError{StatusCode: http.StatusUnauthorized}), want: exitAuthError},
+		{name: "notion unauthorized", err: &notion.APIError{StatusCode: http.StatusUnauthorized}, want: exitAuthError},
+		{name: "coded error wins", err: fmt.Errorf("wrapped: %w", withCode(exitTotalFailure, errors.New("fetch"))), want: exitTotalFailure},
+		{name: "safety abort", err: withCode(exitSafetyAbort, errors.New("too many")), want: exitSafetyAbort},
+
+		{name: "one failure", counts: report.Counts{Tasks: 10, Updated: 9, Failed: 1}, want: exitPartialFailure},
+		{name: "all failed", counts: report.Counts{Tasks: 3, Failed: 3}, want: exitTotalFailure},
+		{name: "within count", counts: report.Counts{Tasks: 10, Updated: 8, Failed: 2}, threshold: config.FailureThreshold{Count: 2}, want: exitOK},
+		{name: "over count", counts: report.Counts{Tasks: 10, Updated: 7, Failed: 3}, threshold: config.FailureThreshold{Count: 2}, want: exitPartialFailure},
+		{name: "within percent", counts: report.Counts{Tasks: 10, Updated: 9, Failed: 1}, threshold: config.FailureThreshold{Percent: 10}, want: exitOK},
+		{name: "over percent", counts: report.Counts{Tasks: 10, Updated: 8, Failed: 2}, threshold: config.FailureThreshold{Percent: 10}, want: exitPartialFailure},
+
+		// 关联和完成状态的写入失败同样计入阈值
+		{name: "completion failures", counts: report.Counts{Tasks: 4, Updated: 4, CompleteFailed: 4}, want: exitPartialFailure},
+		{name: "relation failures", counts: report.Counts{Tasks: 4, Updated: 4, RelationsFailed: 1}, want: exitPartialFailure},
+		{name: "mixed within count", counts: report.Counts{Tasks: 4, Updated: 3, Failed: 1, CompleteFailed: 1}, threshold: config.FailureThreshold{Count: 2}, want: exitOK},
+		{name: "no tasks, completion failed", counts: report.Counts{CompleteFailed: 2}, threshold: config.FailureThreshold{Percent: 50}, want: exitPartialFailure},
+		{name: "no tasks, completion failed, no threshold", counts: report.Counts{CompleteFailed: 1}, want: exitPartialFailure},
+	}
+	for _, tt := range tests {
+		rep := report.New()
+		rep.Counts = tt.counts
+		if got := exitCodeFor(tt.err, rep, tt.threshold); got != tt.want {
+			t.Errorf("%s: exitCodeFor = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
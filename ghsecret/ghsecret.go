@@ -0,0 +1,143 @@
+// Package ghsecret 通过 GitHub REST API 更新 Actions 仓库 secret
+package ghsecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// DefaultAPIURL GitHub REST API 地址；在 Actions 中可使用 GITHUB_API_URL（GitHub Enterprise）
+const DefaultAPIURL = "https://api.github.com"
+
+// Client GitHub Actions secret 客户端
+type Client struct {
+	apiURL     string
+	token      string
+	repo       string // owner/repo
+	httpClient *http.Client
+}
+
+// NewClient 创建客户端；token 需要仓库 secrets 的写权限（Actions 自带的 GITHUB_TOKEN 没有该权限）
+func NewClient(apiURL, token, repo string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		apiURL:     strings.TrimRight(apiURL, "/"),
+		token:      token,
+		repo:       repo,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// APIError GitHub API 返回的错误
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API error: %d - %s", e.StatusCode, e.Body)
+}
+
+// PublicKey 仓库用于加密 secret 的公钥
+type PublicKey struct {
+	KeyID string `json:"key_id"`
+	Key   string `json:"key"` // base64 编码的 Curve25519 公钥
+}
+
+// GetPublicKey 获取仓库的 secret 公钥
+func (c *Client) GetPublicKey(ctx context.Context) (*PublicKey, error) {
+	var key PublicKey
+	if err := c.do(ctx, "GET", "/repos/"+c.repo+"/actions/secrets/public-key", nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// PutSecret 加密并创建或更新仓库 secret
+func (c *Client) PutSecret(ctx context.Context, name, value string) error {
+	key, err := c.GetPublicKey(ctx)
+	if err != nil {
+		return fmt.Errorf("get public key: %w", err)
+	}
+	encrypted, err := Encrypt(key.Key, []byte(value))
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{
+		"encrypted_value": encrypted,
+		"key_id":          key.KeyID,
+	}
+	return c.do(ctx, "PUT", "/repos/"+c.repo+"/actions/secrets/"+url.PathEscape(name), body, nil)
+}
+
+// Encrypt 使用 libsodium sealed box（crypto_box_seal）加密，返回 base64 编码的密文
+func Encrypt(publicKey string, value []byte) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid public key")
+	}
+	var key [32]byte
+	copy(key[:], raw)
+
+	sealed, err := box.SealAnonymous(nil, value, &key, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reqBody *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	if result != nil {
+		return json.Unmarshal(respBody, result)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package ghsecret
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// fakeGitHub 模拟仓库的 public-key 和 secret 接口，保存收到的 secret 请求体
+type fakeGitHub struct {
+	pub, priv *[32]byte
+	secrets   map[string]map[string]string
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *httptest.Server) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeGitHub{pub: pub, priv: priv, secrets: make(map[string]map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/actions/secrets/public-key", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Authorization") != "Bearer gh-token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(PublicKey{KeyID: "key-1", Key: base64.StdEncoding.EncodeToString(pub[:])})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/secrets/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		f.secrets[r.URL.Path[len("/repos/owner/repo/actions/secrets/"):]] = body
+		w.WriteHeader(http.StatusCreated)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func TestPutSecret(t *testing.T) {
+	f, srv := newFakeGitHub(t)
+	c := NewClient(srv.URL+"/", "gh-token", "owner/repo")
+
+	if err := c.PutSecret(context.Background(), "DIDA_TOKEN", `{"access_token":"x"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := f.secrets["DIDA_TOKEN"]
+	if !ok {
+		t.Fatalf("secret DIDA_TOKEN not written, got %v", f.secrets)
+	}
+	if body["key_id"] != "key-1" {
+		t.Errorf("key_id = %q, want key-1", body["key_id"])
+	}
+	sealed, err := base64.StdEncoding.DecodeString(body["encrypted_value"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, ok := box.OpenAnonymous(nil, sealed, f.pub, f.priv)
+	if !ok {
+		t.Fatal("encrypted_value cannot be opened with the repository key")
+	}
+	if string(plaintext) != `{"access_token":"x"}` {
+		t.Errorf("decrypted value = %q", plaintext)
+	}
+}
+
+func TestPutSecretAPIError(t *testing.T) {
+	_, srv := newFakeGitHub(t)
+	c := NewClient(srv.URL, "wrong-token", "owner/repo")
+
+	err := c.PutSecret(context.Background(), "DIDA_TOKEN", "value")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("PutSecret = %v, want APIError 400", err)
+	}
+}
+
+func TestEncryptRejectsInvalidKey(t *testing.T) {
+	for _, key := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := Encrypt(key, []byte("value")); err == nil {
+			t.Errorf("Encrypt(%q) succeeded", key)
+		}
+	}
+}
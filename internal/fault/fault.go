@@ -0,0 +1,111 @@
+// Package fault 为测试用的 HTTP 假服务器注入故障：限流、服务端错误和延迟
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault 一条故障规则。匹配的请求先等待 Latency，Status 非零时直接返回该状态码，
+// 否则继续交给假服务器正常处理（只注入延迟）。Applied 为 true 时请求仍由假服务器处理，
+// 但响应被替换为 Status，模拟请求已生效而响应丢失（如网关超时）
+type Fault struct {
+	Method     string        // 请求方法，为空匹配所有方法
+	Path       string        // 路径前缀，为空匹配所有路径
+	Status     int           // 返回的状态码，0 表示不拦截
+	RetryAfter int           // 大于 0 时设置 Retry-After 头（秒）
+	Body       string        // 响应体，为空时使用 DefaultBody
+	Latency    time.Duration // 处理前等待的时间
+	Times      int           // 生效次数，0 表示一直生效
+	Applied    bool          // 先由假服务器处理请求，再返回 Status
+}
+
+// DefaultBody Fault.Body 为空时的响应体
+const DefaultBody = `{"error":"injected fault"}`
+
+type rule struct {
+	fault Fault
+	hits  int
+}
+
+// Injector 故障规则集合，按添加顺序匹配第一条仍然生效的规则
+type Injector struct {
+	mu    sync.Mutex
+	rules []*rule
+}
+
+// Add 添加故障规则
+func (in *Injector) Add(f Fault) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = append(in.rules, &rule{fault: f})
+}
+
+// Reset 清除所有故障规则
+func (in *Injector) Reset() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = nil
+}
+
+// match 查找匹配请求的规则并计数，没有匹配时返回 false
+func (in *Injector) match(r *http.Request) (Fault, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, ru := range in.rules {
+		f := ru.fault
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 && ru.hits >= f.Times {
+			continue
+		}
+		ru.hits++
+		return f, true
+	}
+	return Fault{}, false
+}
+
+// Wrap 在 next 之前应用故障规则
+func (in *Injector) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := in.match(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.Latency > 0 {
+			select {
+			case <-time.After(f.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.Status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if f.Applied {
+			next.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+		}
+		body := f.Body
+		if body == "" {
+			body = DefaultBody
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.Status)
+		w.Write([]byte(body))
+	})
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/state"
+)
+
+const (
+	// taskIndexMaxAge 收到未知任务的事件时，索引超过该时间才会重新从滴答清单获取
+	taskIndexMaxAge = time.Minute
+
+	// maxWebhookBody webhook 请求体的最大字节数
+	maxWebhookBody = 1 << 20
+)
+
+// taskIndex 滴答任务 ID -> 任务的内存索引，用于根据 Notion 页面找到任务所在的项目
+type taskIndex struct {
+	mu      sync.Mutex
+	tasks   map[string]dida.Task
+	updated time.Time
+}
+
+// set 用最新获取的任务替换索引内容
+func (i *taskIndex) set(tasks []dida.Task) {
+	m := make(map[string]dida.Task, len(tasks))
+	for _, task := range tasks {
+		m[task.ID] = task
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.tasks = m
+	i.updated = time.Now()
+}
+
+func (i *taskIndex) get(id string) (dida.Task, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	task, ok := i.tasks[id]
+	return task, ok
+}
+
+func (i *taskIndex) setStatus(id string, status int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if task, ok := i.tasks[id]; ok {
+		task.Status = status
+		i.tasks[id] = task
+	}
+}
+
+func (i *taskIndex) age() time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.updated.IsZero() {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Since(i.updated)
+}
+
+// pageEvent 待处理的 Notion 页面变更：webhook 只携带页面 ID，轮询则直接带有页面内容
+type pageEvent struct {
+	pageID string
+	page   *notion.Page
+	done   func() // 处理完成后调用，可为空；轮询用它前移游标
+}
+
+// statusListener 接收 Notion 页面变更（webhook 或轮询），把“完成”状态近实时同步回滴答清单
+type statusListener struct {
+	cfg      *config.Config
+	sessions []*session // 配置了 Notion 的账号，页面按 滴答ID 前缀分发到对应账号
+	events   chan pageEvent
+
+	mu       sync.Mutex
+	inflight map[string]int // 数据库 ID -> 轮询放入队列、还没有处理完的事件数
+}
+
+// startStatusListener 按配置启动 webhook 服务和/或轮询，返回前所有后台协程已启动
+func startStatusListener(cfg *config.Config, sessions []*session) error {
+	l := &statusListener{
+		cfg:    cfg,
+		events: make(chan pageEvent, 100),
+	}
+	for _, sess := range sessions {
+		if sess.notion != nil {
+			l.sessions = append(l.sessions, sess)
+		}
+	}
+	if len(l.sessions) == 0 {
+		return fmt.Errorf("未配置 Notion，无法监听页面变更")
+	}
+	go l.worker()
+
+	if cfg.NotionWebhookAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc(cfg.NotionWebhookPath, l.handleWebhook)
+		server := &http.Server{Addr: cfg.NotionWebhookAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Error("Notion webhook 服务退出", "addr", cfg.NotionWebhookAddr, "error", err)
+			}
+		}()
+		go func() {
+			<-shutdown
+			server.Shutdown(context.Background())
+		}()
+		logger.Info(fmt.Sprintf("已启动 Notion webhook 监听: %s%s", cfg.NotionWebhookAddr, cfg.NotionWebhookPath))
+	}
+
+	if cfg.NotionPollInterval > 0 {
+		// 每个数据库只轮询一次，多个账号共用数据库时使用其中第一个账号的客户端
+		polled := make(map[string]bool)
+		for _, sess := range l.sessions {
+			databaseID := sess.account.NotionDatabaseID
+			if polled[databaseID] {
+				continue
+			}
+			polled[databaseID] = true
+			go l.poll(sess, cfg.NotionPollInterval)
+		}
+		logger.Info(fmt.Sprintf("已启动 Notion 变更轮询，间隔 %v", cfg.NotionPollInterval))
+	}
+	return nil
+}
+
+// webhookPayload Notion webhook 请求体中用到的字段
+type webhookPayload struct {
+	VerificationToken string `json:"verification_token"`
+	Type              string `json:"type"`
+	Entity            struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"entity"`
+}
+
+// handleWebhook 处理 Notion webhook 请求
+func (l *statusListener) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// 创建订阅时 Notion 发送一次未签名的验证请求，其中的 verification_token 同时是之后签名使用的密钥。
+	// 令牌不写入日志，只保存到仅当前用户可读的文件；已配置密钥时不再接受未签名的验证请求
+	if payload.VerificationToken != "" && l.cfg.NotionWebhookSecret == "" {
+		path := webhookTokenFile(l.cfg)
+		if err := ioutil.WriteFile(path, []byte(payload.VerificationToken+"\n"), 0600); err != nil {
+			logger.Error("保存 Notion webhook 验证令牌失败", "path", path, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logger.Warn(fmt.Sprintf("收到 Notion webhook 验证请求，verification_token 已保存到 %s，请在 Notion 中完成验证并将其配置为 NOTION_WEBHOOK_SECRET", path),
+			"remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !verifySignature(l.cfg.NotionWebhookSecret, body, r.Header.Get("X-Notion-Signature")) {
+		logger.Warn("Notion webhook 签名校验失败", "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if payload.Entity.Type != "page" || !strings.HasPrefix(payload.Type, "page.") {
+		return
+	}
+	logger.Debug("收到 Notion webhook 事件", "event", payload.Type, "page_id", payload.Entity.ID)
+	l.enqueue(pageEvent{pageID: payload.Entity.ID})
+}
+
+// webhookTokenFile 验证令牌的保存位置，与状态文件放在同一目录
+func webhookTokenFile(cfg *config.Config) string {
+	return filepath.Join(filepath.Dir(cfg.StateFile), ".notion_webhook_token")
+}
+
+// verifySignature 校验 X-Notion-Signature（sha256=<HMAC-SHA256(body) 的十六进制>）
+func verifySignature(secret string, body []byte, header string) bool {
+	if secret == "" || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// enqueue 将事件放入处理队列，队列已满时丢弃并返回 false（轮询或下次同步会补上）
+func (l *statusListener) enqueue(ev pageEvent) bool {
+	select {
+	case l.events <- ev:
+		return true
+	default:
+		logger.Warn("Notion 变更事件队列已满，丢弃事件", "page_id", ev.pageID)
+		return false
+	}
+}
+
+// poll 按间隔查询 sess 所在数据库中 last_edited_time 晚于游标的页面
+func (l *statusListener) poll(sess *session, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.pollOnce(context.Background(), sess); err != nil {
+			logger.Error("轮询 Notion 变更失败", "database_id", sess.account.NotionDatabaseID, "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// pollOnce 把游标之后修改过的页面放入队列。游标在每个事件处理完成后才前移，
+// 进程在处理前退出时下次从未处理的页面开始；上一轮的事件还没有处理完时不查询，避免重复放入
+func (l *statusListener) pollOnce(ctx context.Context, sess *session) error {
+	databaseID := sess.account.NotionDatabaseID
+	if l.pending(databaseID) > 0 {
+		return nil
+	}
+	st, err := state.Load(l.cfg.StateFile)
+	if err != nil {
+		return err
+	}
+	cursor := st.PollCursor(databaseID)
+	if cursor.IsZero() {
+		// 首次轮询只关心从现在开始的变更，历史状态由常规同步处理
+		cursor = time.Now().Add(-l.cfg.NotionPollInterval)
+		if err := state.Update(l.cfg.StateFile, func(st *state.State) {
+			st.SetPollCursor(databaseID, cursor)
+		}); err != nil {
+			return err
+		}
+	}
+
+	pages, err := sess.notion.GetPagesEditedSince(ctx, cursor)
+	if err != nil {
+		return err
+	}
+
+	// 按修改时间顺序放入队列，队列满时停在第一个被丢弃的页面，游标不会越过它。
+	// 查询条件是 on_or_after，与游标同一时间的页面会重复处理，状态更新是幂等的
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].LastEditedTime.Before(pages[j].LastEditedTime)
+	})
+	for i := range pages {
+		edited := pages[i].LastEditedTime
+		l.track(databaseID, 1)
+		ev := pageEvent{pageID: pages[i].ID, page: &pages[i], done: func() {
+			l.track(databaseID, -1)
+			l.advanceCursor(databaseID, edited)
+		}}
+		if !l.enqueue(ev) {
+			l.track(databaseID, -1)
+			break
+		}
+	}
+	return nil
+}
+
+// pending 返回数据库还没有处理完的轮询事件数
+func (l *statusListener) pending(databaseID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight[databaseID]
+}
+
+func (l *statusListener) track(databaseID string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight == nil {
+		l.inflight = make(map[string]int)
+	}
+	l.inflight[databaseID] += n
+}
+
+// advanceCursor 页面处理完成后把数据库的游标前移到它的修改时间；事件按修改时间顺序处理，游标只前移不回退
+func (l *statusListener) advanceCursor(databaseID string, edited time.Time) {
+	err := state.Update(l.cfg.StateFile, func(st *state.State) {
+		if edited.After(st.PollCursor(databaseID)) {
+			st.SetPollCursor(databaseID, edited)
+		}
+	})
+	if err != nil {
+		logger.Warn("警告: 保存轮询游标失败", "database_id", databaseID, "error", err)
+	}
+}
+
+// worker 依次处理页面变更，保证同一时间只有一个状态更新在进行
+func (l *statusListener) worker() {
+	ctx := context.Background()
+	for {
+		select {
+		case ev := <-l.events:
+			l.handlePage(ctx, ev)
+			if ev.done != nil {
+				ev.done()
+			}
+		case <-shutdown:
+			return
+		}
+	}
+}
+
+// handlePage 如果页面在 Notion 中已标记为完成而滴答清单中未完成，则更新滴答清单
+func (l *statusListener) handlePage(ctx context.Context, ev pageEvent) {
+	page := ev.page
+	if page == nil {
+		var err error
+		if page, err = l.fetchPage(ctx, ev.pageID); err != nil {
+			logger.Error("获取 Notion 页面失败", "page_id", ev.pageID, "error", err)
+			return
+		}
+	}
+
+	key, ok := extractDidaIDFromPage(*page)
+	if !ok {
+		return
+	}
+	status, ok := extractStatusFromPage(*page)
+	if !ok || status != "完成" {
+		return
+	}
+	sess, didaID, ok := l.route(page, key)
+	if !ok {
+		logger.Debug("页面不属于已配置的账号，忽略", "task_id", key, "page_id", page.ID)
+		return
+	}
+	log := logger.With("task_id", key, "page_id", page.ID)
+
+	task, ok := l.lookupTask(ctx, sess, didaID)
+	if !ok {
+		log.Debug("滴答清单中不存在该任务，忽略")
+		return
+	}
+	if task.Status == 2 {
+		return
+	}
+
+	if err := sess.dida.UpdateTaskStatus(ctx, task.ProjectID, task.ID, 2); err != nil {
+		log.Error(fmt.Sprintf("更新 TickTick 任务状态失败: %s", task.Title), "error", err)
+		return
+	}
+	sess.tasks.setStatus(task.ID, 2)
+	syncMetrics.AddTasks("completed", 1)
+	log.Info(fmt.Sprintf("已同步完成状态到 TickTick: %s", task.Title))
+}
+
+// fetchPage 获取 webhook 事件中的页面。webhook 只有页面 ID，各账号可能使用不同的 Notion 集成，
+// 依次用每个数据库的客户端尝试，返回第一个能读取到的结果
+func (l *statusListener) fetchPage(ctx context.Context, pageID string) (*notion.Page, error) {
+	var lastErr error
+	tried := make(map[string]bool)
+	for _, sess := range l.sessions {
+		databaseID := sess.account.NotionDatabaseID
+		if tried[databaseID] {
+			continue
+		}
+		tried[databaseID] = true
+		page, err := sess.notion.GetPage(ctx, pageID)
+		if err == nil {
+			return page, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// route 根据页面所在数据库和 滴答ID 前缀找到页面所属的账号，返回去掉前缀的任务 ID
+func (l *statusListener) route(page *notion.Page, key string) (*session, string, bool) {
+	for _, sess := range l.sessions {
+		if !page.InDatabase(sess.account.NotionDatabaseID) {
+			continue
+		}
+		if id, ok := sess.ns.taskID(key); ok {
+			return sess, id, true
+		}
+	}
+	return nil, "", false
+}
+
+// lookupTask 在账号的索引中查找任务，找不到且索引已过期时重新获取一次
+func (l *statusListener) lookupTask(ctx context.Context, sess *session, id string) (dida.Task, bool) {
+	if task, ok := sess.tasks.get(id); ok {
+		return task, true
+	}
+	if sess.tasks.age() < taskIndexMaxAge {
+		return dida.Task{}, false
+	}
+
+	// 部分项目获取失败时仍使用获取到的任务
+	tasks, err := sess.dida.GetAllTasks(ctx)
+	var partial *dida.PartialError
+	if errors.As(err, &partial) {
+		logger.Warn("部分任务获取失败", "account", sess.account.Name, "error", err)
+	} else if err != nil {
+		logger.Error("获取任务失败", "account", sess.account.Name, "error", err)
+		return dida.Task{}, false
+	}
+	sess.tasks.set(tasks)
+	return sess.tasks.get(id)
+}
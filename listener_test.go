@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/state"
+)
+
+const testWebhookSecret = "secret_test"
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"type":"page.properties_updated"}`)
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"valid", testWebhookSecret, sign(testWebhookSecret, string(body)), true},
+		{"wrong secret", testWebhookSecret, sign("other", string(body)), false},
+		{"no secret configured", "", sign("", string(body)), false},
+		{"missing prefix", testWebhookSecret, strings.TrimPrefix(sign(testWebhookSecret, string(body)), "sha256="), false},
+		{"not hex", testWebhookSecret, "sha256=zz", false},
+		{"empty", testWebhookSecret, "", false},
+	}
+	for _, tt := range tests {
+		if got := verifySignature(tt.secret, body, tt.header); got != tt.want {
+			t.Errorf("%s: verifySignature = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func newTestListener(cfg *config.Config, queue int) *statusListener {
+	return &statusListener{cfg: cfg, events: make(chan pageEvent, queue)}
+}
+
+func postWebhook(l *statusListener, method, body, signature string) int {
+	req := httptest.NewRequest(method, "/notion/webhook", strings.NewReader(body))
+	if signature != "" {
+		req.Header.Set("X-Notion-Signature", signature)
+	}
+	rec := httptest.NewRecorder()
+	l.handleWebhook(rec, req)
+	return rec.Code
+}
+
+func TestHandleWebhook(t *testing.T) {
+	oldLogger := logger
+	logger = logging.Nop()
+	defer func() { logger = oldLogger }()
+
+	event := `{"type":"page.properties_updated","entity":{"id":"page-1","type":"page"}}`
+	handshake := `{"verification_token":"secret_new"}`
+	tests := []struct {
+		name       string
+		secret     string
+		method     string
+		body       string
+		signature  string
+		wantStatus int
+		wantEvent  string
+	}{
+		{"wrong method", testWebhookSecret, http.MethodGet, "", "", http.StatusMethodNotAllowed, ""},
+		{"invalid json", testWebhookSecret, http.MethodPost, "{", "", http.StatusBadRequest, ""},
+		{"unsigned event", testWebhookSecret, http.MethodPost, event, "", http.StatusUnauthorized, ""},
+		{"bad signature", testWebhookSecret, http.MethodPost, event, sign("other", event), http.StatusUnauthorized, ""},
+		{"signed event", testWebhookSecret, http.MethodPost, event, sign(testWebhookSecret, event), http.StatusOK, "page-1"},
+		{"non-page event", testWebhookSecret, http.MethodPost, `{"type":"database.created","entity":{"id":"db","type":"database"}}`,
+			sign(testWebhookSecret, `{"type":"database.created","entity":{"id":"db","type":"database"}}`), http.StatusOK, ""},
+		// 未配置密钥时接受验证请求，配置后未签名的验证请求与普通事件一样被拒绝
+		{"handshake before secret", "", http.MethodPost, handshake, "", http.StatusOK, ""},
+		{"handshake after secret", testWebhookSecret, http.MethodPost, handshake, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{NotionWebhookSecret: tt.secret, StateFile: filepath.Join(t.TempDir(), "state.json")}
+		l := newTestListener(cfg, 1)
+		if got := postWebhook(l, tt.method, tt.body, tt.signature); got != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.wantStatus)
+		}
+		var gotEvent string
+		select {
+		case ev := <-l.events:
+			gotEvent = ev.pageID
+		default:
+		}
+		if gotEvent != tt.wantEvent {
+			t.Errorf("%s: enqueued %q, want %q", tt.name, gotEvent, tt.wantEvent)
+		}
+		// 只有被接受的验证请求会保存令牌
+		token, _ := ioutil.ReadFile(webhookTokenFile(cfg))
+		if want := tt.name == "handshake before secret"; want != (string(token) == "secret_new\n") {
+			t.Errorf("%s: saved token = %q", tt.name, token)
+		}
+	}
+}
+
+func TestPollOnceAdvancesCursorAfterHandling(t *testing.T) {
+	env := newE2E(t)
+	defer env.close()
+	env.cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	env.cfg.NotionPollInterval = time.Minute
+
+	start := env.clock.Now()
+	if err := state.Update(env.cfg.StateFile, func(st *state.State) {
+		st.SetPollCursor(testDatabaseID, start)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var times []time.Time
+	for _, id := range []string{"a", "b", "c"} {
+		env.clock.Advance(time.Minute)
+		times = append(times, env.clock.Now())
+		env.notion.AddPage(testDatabaseID, notion.Properties{"滴答ID": notion.DidaIDProperty(id)})
+	}
+
+	// 队列只能放下两个事件，最后一个页面被丢弃
+	l := newTestListener(env.cfg, 2)
+	l.sessions = env.sessions
+	sess := env.sessions[0]
+	cursor := func() time.Time {
+		st, err := state.Load(env.cfg.StateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st.PollCursor(testDatabaseID)
+	}
+
+	if err := l.pollOnce(context.Background(), sess); err != nil {
+		t.Fatal(err)
+	}
+	if got := cursor(); !got.Equal(start) {
+		t.Fatalf("cursor = %v before the event was handled, want %v", got, start)
+	}
+
+	// 事件还没处理时再次轮询不会重复放入
+	before := len(env.notion.Requests())
+	if err := l.pollOnce(context.Background(), sess); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.notion.Requests()) != before || len(l.events) != 2 {
+		t.Fatalf("polled again with %d events pending", len(l.events))
+	}
+
+	// 处理事件后游标前移到最后处理的页面，不越过被丢弃的页面；之后的轮询补上剩余页面
+	var seen []string
+	drain := func() {
+		for len(l.events) > 0 {
+			ev := <-l.events
+			key, _ := extractDidaIDFromPage(*ev.page)
+			seen = append(seen, key)
+			ev.done()
+		}
+	}
+	drain()
+	if got := cursor(); !got.Equal(times[1]) {
+		t.Fatalf("cursor = %v, want %v (last handled page)", got, times[1])
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.pollOnce(context.Background(), sess); err != nil {
+			t.Fatal(err)
+		}
+		drain()
+	}
+	if got := cursor(); !got.Equal(times[2]) {
+		t.Errorf("cursor = %v, want %v", got, times[2])
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		found := false
+		for _, key := range seen {
+			found = found || key == id
+		}
+		if !found {
+			t.Errorf("page %q never enqueued, saw %v", id, seen)
+		}
+	}
+}
+
+func TestRouteMatchesPageDatabase(t *testing.T) {
+	cfg := &config.Config{}
+	work := config.Account{Name: "work", NotionDatabaseID: "aaaa-1111"}
+	home := config.Account{Name: "home", NotionDatabaseID: "bbbb-2222"}
+	l := newTestListener(cfg, 1)
+	for _, acc := range []config.Account{work, home} {
+		l.sessions = append(l.sessions, &session{cfg: cfg, account: acc, ns: newNamespace(acc, "")})
+	}
+
+	page := &notion.Page{ID: "p", Parent: notion.PageParent{Type: "database_id", DatabaseID: "BBBB2222"}}
+	sess, id, ok := l.route(page, "home:task-1")
+	if !ok || sess.account.Name != "home" || id != "task-1" {
+		t.Errorf("route = %v %q %v, want home task-1", sess, id, ok)
+	}
+	// 前缀属于另一个账号，但页面不在该账号的数据库中
+	if _, _, ok := l.route(page, "work:task-1"); ok {
+		t.Error("page routed to an account whose database it is not in")
+	}
+}
@@ -0,0 +1,241 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 返回级别名称
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel 解析日志级别名称
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("未知的日志级别: %q", s)
+}
+
+// Format 日志输出格式
+type Format int
+
+const (
+	// FormatText 人类可读格式，只输出消息本身（与原有的进度输出一致）和 error 字段，
+	// debug 级别下附加所有 key=value 字段
+	FormatText Format = iota
+	// FormatJSON 每行一个 JSON 对象，包含时间、级别、消息和所有字段
+	FormatJSON
+)
+
+// ParseFormat 解析输出格式名称
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("未知的日志格式: %q", s)
+}
+
+// Logger 带级别和键值字段的日志记录器，可安全地并发使用
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	errOut io.Writer // warn 及以上级别的输出
+	level  Level
+	format Format
+	fields []interface{}
+}
+
+// New 创建所有级别都输出到 out 的日志记录器
+func New(out io.Writer, level Level, format Format) *Logger {
+	return NewSplit(out, out, level, format)
+}
+
+// NewSplit 创建日志记录器，warn 及以上级别输出到 errOut，其余输出到 out
+func NewSplit(out, errOut io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		errOut: errOut,
+		level:  level,
+		format: format,
+	}
+}
+
+// Default 返回文本格式 info 级别日志记录器，警告和错误输出到 stderr，其余输出到 stdout
+func Default() *Logger {
+	return NewSplit(os.Stdout, os.Stderr, LevelInfo, FormatText)
+}
+
+// Nop 返回丢弃所有输出的日志记录器
+func Nop() *Logger {
+	return New(ioutil.Discard, LevelError+1, FormatText)
+}
+
+// With 返回附加了键值字段的子记录器，kv 为交替的键和值
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{
+		mu:     l.mu,
+		out:    l.out,
+		errOut: l.errOut,
+		level:  l.level,
+		format: l.format,
+		fields: fields,
+	}
+}
+
+// Enabled 判断给定级别是否会被输出
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug 输出 debug 级别日志
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+// Info 输出 info 级别日志
+func (l *Logger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+// Warn 输出 warn 级别日志
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+// Error 输出 error 级别日志
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+// Debugf 以格式化字符串输出 debug 级别日志
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.Enabled(LevelDebug) {
+		l.log(LevelDebug, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// Infof 以格式化字符串输出 info 级别日志
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// Warnf 以格式化字符串输出 warn 级别日志
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+// Errorf 以格式化字符串输出 error 级别日志
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = append(append([]interface{}{}, l.fields...), kv...)
+	}
+
+	var line []byte
+	if l.format == FormatJSON {
+		line = l.formatJSON(level, msg, fields)
+	} else {
+		line = l.formatText(msg, fields)
+	}
+
+	out := l.out
+	if level >= LevelWarn {
+		out = l.errOut
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out.Write(line)
+}
+
+// formatText 只输出消息；有 error 字段时附加在消息后，debug 级别下附加所有字段
+func (l *Logger) formatText(msg string, fields []interface{}) []byte {
+	var b strings.Builder
+	b.WriteString(msg)
+	if l.level == LevelDebug {
+		for i := 0; i < len(fields); i += 2 {
+			fmt.Fprintf(&b, " %v=%v", fields[i], fieldValue(fields, i+1))
+		}
+	} else {
+		for i := 0; i < len(fields); i += 2 {
+			if fields[i] == "error" {
+				fmt.Fprintf(&b, ": %v", fieldValue(fields, i+1))
+			}
+		}
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+func (l *Logger) formatJSON(level Level, msg string, fields []interface{}) []byte {
+	entry := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   strings.TrimSpace(msg),
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		value := fieldValue(fields, i+1)
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"level": level.String(),
+			"msg":   strings.TrimSpace(msg),
+			"error": err.Error(),
+		})
+	}
+	return append(data, '\n')
+}
+
+// fieldValue 取出第 i 个字段值，键值不成对时返回占位符
+func fieldValue(fields []interface{}, i int) interface{} {
+	if i < len(fields) {
+		return fields[i]
+	}
+	return "(missing)"
+}
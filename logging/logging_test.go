@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"", LevelInfo, false},
+		{"debug", LevelDebug, false},
+		{" INFO ", LevelInfo, false},
+		{"warning", LevelWarn, false},
+		{"warn", LevelWarn, false},
+		{"error", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{"", FormatText, false},
+		{"text", FormatText, false},
+		{"JSON", FormatJSON, false},
+		{"logfmt", FormatText, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFormat(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelWarn, FormatText)
+	l.Debug("debug")
+	l.Info("info")
+	l.Infof("info %d", 2)
+	l.Warn("warn")
+	l.Error("error")
+	if got, want := out.String(), "warn\nerror\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if l.Enabled(LevelInfo) || !l.Enabled(LevelError) {
+		t.Error("Enabled does not match the level")
+	}
+
+	out.Reset()
+	Nop().Error("dropped")
+	if out.Len() != 0 {
+		t.Errorf("Nop wrote %q", out.String())
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo, FormatText).With("account", "work")
+	l.Info("已更新", "page_id", "p1")
+	l.Warn("警告: 保存状态文件失败", "file", ".sync_state.json", "error", errors.New("permission denied"))
+	want := "已更新\n警告: 保存状态文件失败: permission denied\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// debug 级别下附加所有字段
+	out.Reset()
+	New(&out, LevelDebug, FormatText).With("account", "work").Info("已更新", "page_id", "p1", "odd")
+	if got, want := out.String(), "已更新 account=work page_id=p1 odd=(missing)\n"; got != want {
+		t.Errorf("debug output = %q, want %q", got, want)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo, FormatJSON).With("account", "work")
+	l.Error("\n获取任务失败", "count", 3, "error", errors.New("timeout"))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	want := map[string]interface{}{
+		"level": "error", "msg": "获取任务失败", "account": "work", "count": float64(3), "error": "timeout",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("missing time")
+	}
+	// 错误只出现在 error 字段中
+	if strings.Contains(entry["msg"].(string), "timeout") {
+		t.Errorf("msg repeats the error: %q", entry["msg"])
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	var out, errOut bytes.Buffer
+	l := NewSplit(&out, &errOut, LevelInfo, FormatText).With("account", "work")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	if got := out.String(); got != "info\n" {
+		t.Errorf("stdout = %q, want info only", got)
+	}
+	if got := errOut.String(); got != "warn\nerror\n" {
+		t.Errorf("stderr = %q, want warn and error", got)
+	}
+}
@@ -2,257 +2,263 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
+	"dida-to-notion-sync/clock"
 	"dida-to-notion-sync/config"
 	"dida-to-notion-sync/dida"
-	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/metrics"
+	"dida-to-notion-sync/report"
+	"dida-to-notion-sync/state"
 )
 
-const tokenFile = ".token"
+const (
+	// rateLimitDelay 连续调用 Notion API 之间的间隔，避免触发限流
+	rateLimitDelay = 350 * time.Millisecond
 
-func main() {
-	// 加载配置
-	cfg, err := config.Load()
-	if err != nil {
-		fmt.Printf("加载配置失败: %v\n", err)
-		os.Exit(1)
-	}
-
-	if cfg.DidaClientID == "" || cfg.DidaClientSecret == "" {
-		fmt.Println("请在 .env 文件中配置 DIDA_CLIENT_ID 和 DIDA_CLIENT_SECRET")
-		os.Exit(1)
-	}
+	// tokenRefreshMargin token 剩余有效期低于该值时主动刷新
+	tokenRefreshMargin = 24 * time.Hour
+)
 
-	// 创建 OAuth 客户端
-	oauth := dida.NewOAuth(cfg.DidaClientID, cfg.DidaClientSecret, cfg.DidaRedirectURL)
+var (
+	// logger 同步过程使用的日志记录器，在 main 中根据命令行参数配置
+	logger = logging.Default()
 
-	// 尝试加载已有的 token
-	if err := oauth.LoadToken(tokenFile); err != nil {
-		fmt.Println("未找到已保存的授权信息，需要重新授权...")
-		if err := authorize(oauth); err != nil {
-			fmt.Printf("授权失败: %v\n", err)
-			os.Exit(1)
-		}
-	} else {
-		fmt.Println("已加载保存的授权信息")
-	}
+	// syncMetrics 同步过程的指标，通过 -metrics-addr 暴露或推送到 Pushgateway
+	syncMetrics = metrics.New()
 
-	// 创建滴答清单 API 客户端
-	didaClient := dida.NewClient(oauth)
-	ctx := context.Background()
+	// syncClock 同步过程使用的时钟（限流等待等），测试时可替换
+	syncClock = clock.Real()
+)
 
-	// 获取项目列表（用于映射项目名称）
-	fmt.Println("\n正在获取滴答清单项目...")
-	projects, err := didaClient.GetProjects(ctx)
+func main() {
+	// 加载配置
+	cfg, err := config.Load()
 	if err != nil {
-		fmt.Printf("获取项目失败: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		os.Exit(exitConfigError)
 	}
 
-	// 构建项目ID -> 名称映射
-	projectMap := make(map[string]string)
-	projectMap["inbox"] = "收集箱"
-	for _, p := range projects {
-		projectMap[p.ID] = p.Name
-	}
-	fmt.Printf("找到 %d 个项目\n", len(projects)+1) // +1 for inbox
+	flag.Usage = usage
+	logFormat := flag.String("log-format", cfg.LogFormat, "日志格式: text 或 json")
+	logLevel := flag.String("log-level", cfg.LogLevel, "日志级别: debug, info, warn, error")
+	quiet := flag.Bool("quiet", false, "安静模式，只输出警告和错误（适合 cron）")
+	metricsAddr := flag.String("metrics-addr", cfg.MetricsAddr, "暴露 /metrics 的监听地址，如 :9090（为空则不启用）")
+	flag.BoolVar(&cfg.Force, "force", false, "跳过批量标记完成的安全检查（见 SYNC_MAX_COMPLETE_FRACTION）")
+	flag.Parse()
 
-	// 获取所有任务
-	fmt.Println("正在获取滴答清单任务...")
-	tasks, err := didaClient.GetAllTasks(ctx)
+	logger, err = newLogger(*logFormat, *logLevel, *quiet)
 	if err != nil {
-		fmt.Printf("获取任务失败: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfigError)
 	}
-	fmt.Printf("找到 %d 个任务\n", len(tasks))
 
-	// 检查 Notion 配置
-	if cfg.NotionToken == "" || cfg.NotionDatabaseID == "" {
-		fmt.Println("\n未配置 Notion，跳过同步")
-		fmt.Println("请在 .env 文件中配置 NOTION_TOKEN 和 NOTION_DATABASE_ID")
-		return
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr)
+	}
+	handleSignals()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "", "sync":
+		os.Exit(runOnce(cfg))
+	case "daemon":
+		os.Exit(runDaemon(cfg, flag.Args()[1:]))
+	case "listen":
+		os.Exit(runListen(cfg))
+	case "authorize":
+		os.Exit(runAuthorize(cfg, flag.Args()[1:]))
+	case "dedupe":
+		os.Exit(runDedupe(cfg, flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", cmd)
+		usage()
+		os.Exit(exitConfigError)
 	}
-
-	// 创建 Notion 客户端
-	notionClient := notion.NewClient(cfg.NotionToken, cfg.NotionDatabaseID)
-
-	// 同步任务到 Notion
-	fmt.Println("\n正在同步到 Notion...")
-	syncResult := syncToNotion(ctx, notionClient, tasks, projectMap)
-
-	// 标记已完成的任务
-	fmt.Println("\n正在检查已完成的任务...")
-	completedCount := markCompletedTasks(ctx, notionClient, didaClient, tasks)
-
-	fmt.Printf("\n同步完成！\n")
-	fmt.Printf("  新增: %d\n", syncResult.Created)
-	fmt.Printf("  更新: %d\n", syncResult.Updated)
-	fmt.Printf("  跳过: %d\n", syncResult.Skipped)
-	fmt.Printf("  失败: %d\n", syncResult.Failed)
-	fmt.Printf("  标记完成: %d\n", completedCount)
 }
 
-// SyncResult 同步结果
-type SyncResult struct {
-	Created int
-	Updated int
-	Skipped int
-	Failed  int
+// usage 输出命令行帮助
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "用法: %s [选项] [命令]\n\n", os.Args[0])
+	fmt.Fprintln(out, "命令:")
+	fmt.Fprintln(out, "  sync     执行一次同步（默认）")
+	fmt.Fprintln(out, "  daemon   常驻运行，按间隔或 cron 表达式定时同步")
+	fmt.Fprintln(out, "  listen   只监听 Notion 页面变更，把完成状态近实时同步回滴答清单")
+	fmt.Fprintln(out, "  authorize [-account 名称] [-headless [-allow-bare-code]] [-print-token]")
+	fmt.Fprintln(out, "           重新进行滴答清单授权；-headless 适用于没有浏览器的服务器")
+	fmt.Fprintln(out, "  dedupe [-strategy relations|oldest|recent] [-dry-run] [-account 名称]")
+	fmt.Fprintln(out, "           合并滴答ID 相同的重复页面：迁移关联后归档多余的页面")
+	fmt.Fprintln(out, "\n选项:")
+	flag.PrintDefaults()
 }
 
-// syncToNotion 同步任务到 Notion
-func syncToNotion(ctx context.Context, client *notion.Client, tasks []dida.Task, projectMap map[string]string) SyncResult {
-	result := SyncResult{}
-
-	// 构建 滴答ID -> Notion PageID 的映射（用于关联父子任务）
-	didaToNotionID := make(map[string]string)
-
-	// 第一轮：创建/更新所有任务，收集 ID 映射
-	fmt.Println("第一轮：同步任务...")
-	for i, task := range tasks {
-		// 获取项目名称
-		projectName := projectMap[task.ProjectID]
-		if projectName == "" {
-			projectName = "收集箱"
-		}
-
-		// 检查任务是否已存在
-		existingPage, err := client.FindPageByDidaID(ctx, task.ID)
+// runOnce 执行一次同步并返回进程退出码
+func runOnce(cfg *config.Config) int {
+	rep := report.New()
+	err := func() error {
+		endPhase := rep.StartPhase("auth")
+		sessions, err := newSessions(cfg)
+		endPhase()
 		if err != nil {
-			fmt.Printf("  [%d/%d] 查询失败: %s - %v\n", i+1, len(tasks), task.Title, err)
-			result.Failed++
-			continue
-		}
-
-		// 转换为 Notion 属性（不包含父任务关联）
-		props := notion.TaskToProperties(task, projectName, "")
-
-		if existingPage != nil {
-			// 更新现有页面
-			_, err := client.UpdatePage(ctx, existingPage.ID, props)
-			if err != nil {
-				fmt.Printf("  [%d/%d] 更新失败: %s - %v\n", i+1, len(tasks), task.Title, err)
-				result.Failed++
-			} else {
-				fmt.Printf("  [%d/%d] 已更新: %s\n", i+1, len(tasks), task.Title)
-				result.Updated++
-				didaToNotionID[task.ID] = existingPage.ID
-			}
-		} else {
-			// 创建新页面
-			newPage, err := client.CreatePage(ctx, props)
-			if err != nil {
-				fmt.Printf("  [%d/%d] 创建失败: %s - %v\n", i+1, len(tasks), task.Title, err)
-				result.Failed++
-			} else {
-				fmt.Printf("  [%d/%d] 已创建: %s\n", i+1, len(tasks), task.Title)
-				result.Created++
-				didaToNotionID[task.ID] = newPage.ID
-			}
+			return err
 		}
 
-		// 避免 API 限流
-		time.Sleep(350 * time.Millisecond)
-	}
+		// token 临近过期时刷新并写回，避免 CI 中保存的 token 最终失效
+		refreshTokens(context.Background(), sessions)
 
-	// 第二轮：更新父子任务关联
-	fmt.Println("\n第二轮：关联父子任务...")
-	relationUpdated := 0
-
-	// 构建父任务 -> 子任务列表的映射
-	parentToChildren := make(map[string][]string)
-	for _, task := range tasks {
-		if task.ParentID != "" {
-			childNotionID, ok := didaToNotionID[task.ID]
-			if ok {
-				parentToChildren[task.ParentID] = append(parentToChildren[task.ParentID], childNotionID)
-			}
+		var since time.Time
+		if cfg.Incremental {
+			since = lastSyncTime(cfg)
 		}
+		return syncAll(context.Background(), sessions, rep, since)
+	}()
+	rep.Finish(err)
+
+	code := exitCodeFor(err, rep, cfg.FailureThreshold)
+	saveReport(cfg, rep, code == exitOK)
+	recordRunMetrics(rep, code)
+	if cfg.MetricsPushURL != "" {
+		pushMetrics(cfg.MetricsPushURL, cfg.MetricsJob)
 	}
 
-	for _, task := range tasks {
-		if task.ParentID == "" {
-			continue // 没有父任务，跳过
-		}
+	printErrorSummary(os.Stderr, err, rep, code)
+	return code
+}
 
-		// 获取当前任务的 Notion ID
-		notionID, ok := didaToNotionID[task.ID]
-		if !ok {
-			continue
-		}
+// handleSignals 第一次收到 SIGINT/SIGTERM 时在当前任务完成后停止，第二次立即退出
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		logger.Warn("收到停止信号，完成当前任务后退出（再次发送信号立即退出）")
+		requestShutdown()
+		<-sigs
+		logger.Error("再次收到停止信号，立即退出")
+		os.Exit(exitError)
+	}()
+}
 
-		// 获取父任务的 Notion ID
-		parentNotionID, ok := didaToNotionID[task.ParentID]
-		if !ok {
-			continue
-		}
+// newLogger 根据命令行参数创建日志记录器
+func newLogger(format, level string, quiet bool) (*logging.Logger, error) {
+	f, err := logging.ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	l, err := logging.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if quiet && l < logging.LevelWarn {
+		l = logging.LevelWarn
+	}
+	return logging.NewSplit(os.Stdout, os.Stderr, l, f), nil
+}
 
-		// 更新子任务的父任务关联
-		props := map[string]interface{}{
-			"父任务": map[string]interface{}{
-				"relation": []map[string]interface{}{
-					{"id": parentNotionID},
-				},
-			},
+// serveMetrics 在后台启动 /metrics HTTP 服务
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", syncMetrics.Registry.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("指标服务退出", "addr", addr, "error", err)
 		}
+	}()
+	logger.Debug("指标服务已启动", "addr", addr)
+}
 
-		_, err := client.UpdatePage(ctx, notionID, props)
-		if err != nil {
-			fmt.Printf("  关联失败: %s -> 父任务 - %v\n", task.Title, err)
-		} else {
-			fmt.Printf("  已关联: %s -> 父任务\n", task.Title)
-			relationUpdated++
-		}
+// recordRunMetrics 将运行报告中的统计计入指标
+func recordRunMetrics(rep *report.Run, code int) {
+	syncMetrics.AddTasks("created", rep.Counts.Created)
+	syncMetrics.AddTasks("updated", rep.Counts.Updated)
+	syncMetrics.AddTasks("skipped", rep.Counts.Skipped)
+	syncMetrics.AddTasks("failed", rep.Counts.Failed)
+	syncMetrics.AddTasks("completed", rep.Counts.Completed)
+
+	result := "success"
+	switch code {
+	case exitOK:
+	case exitPartialFailure:
+		result = "partial_failure"
+	default:
+		result = "failure"
+	}
+	syncMetrics.ObserveRun(result, time.Duration(rep.DurationMS)*time.Millisecond)
+}
 
-		time.Sleep(350 * time.Millisecond)
+// pushMetrics 将本次运行的指标推送到 Pushgateway
+func pushMetrics(url, job string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := syncMetrics.Registry.Push(ctx, url, job); err != nil {
+		logger.Warn("警告: 推送指标失败", "url", url, "error", err)
 	}
+}
 
-	// 更新父任务的子任务字段
-	fmt.Println("\n第三轮：更新父任务的子任务列表...")
-	for parentDidaID, childNotionIDs := range parentToChildren {
-		parentNotionID, ok := didaToNotionID[parentDidaID]
-		if !ok {
-			continue
-		}
+// lastSyncTime 返回上次成功同步的开始时间，没有记录时返回零值（即全量同步）
+func lastSyncTime(cfg *config.Config) time.Time {
+	st, err := state.Load(cfg.StateFile)
+	if err != nil {
+		logger.Warn("警告: 加载状态文件失败，执行全量同步", "file", cfg.StateFile, "error", err)
+		return time.Time{}
+	}
+	return st.LastSyncAt
+}
 
-		// 构建子任务关联列表
-		childRelations := make([]map[string]interface{}, len(childNotionIDs))
-		for i, childID := range childNotionIDs {
-			childRelations[i] = map[string]interface{}{"id": childID}
-		}
+// fetchError 包装获取数据阶段的错误：token 无效视为授权错误，其余视为整体失败
+func fetchError(msg string, err error) error {
+	if dida.IsUnauthorized(err) {
+		return withCode(exitAuthError, fmt.Errorf("%s: %w", msg, err))
+	}
+	return withCode(exitTotalFailure, fmt.Errorf("%s: %w", msg, err))
+}
 
-		props := map[string]interface{}{
-			"子任务": map[string]interface{}{
-				"relation": childRelations,
-			},
+// saveReport 输出运行报告，并按配置保存到状态文件的运行历史中；
+// success 为 true 时记录本次运行的开始时间，作为下次增量同步的起点
+func saveReport(cfg *config.Config, rep *report.Run, success bool) {
+	if cfg.ReportFile != "" {
+		if err := rep.WriteFile(cfg.ReportFile); err != nil {
+			logger.Warn("警告: 写入运行报告失败", "file", cfg.ReportFile, "error", err)
 		}
+	}
 
-		_, err := client.UpdatePage(ctx, parentNotionID, props)
-		if err != nil {
-			fmt.Printf("  更新子任务列表失败: %v\n", err)
-		} else {
-			fmt.Printf("  已更新子任务列表 (%d 个子任务)\n", len(childNotionIDs))
+	if cfg.HistorySize <= 0 && !success {
+		return
+	}
+	err := state.Update(cfg.StateFile, func(st *state.State) {
+		if cfg.HistorySize > 0 {
+			st.AddRun(rep, cfg.HistorySize)
 		}
-
-		time.Sleep(350 * time.Millisecond)
+		if success {
+			st.LastSyncAt = rep.StartedAt
+		}
+	})
+	if err != nil {
+		logger.Warn("警告: 保存状态文件失败", "file", cfg.StateFile, "error", err)
 	}
-
-	fmt.Printf("  父子关联更新: %d\n", relationUpdated)
-
-	return result
 }
 
 func authorize(oauth *dida.OAuth) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
+	// 生成随机 state，回调时校验
+	state, err := dida.GenerateState()
+	if err != nil {
+		return fmt.Errorf("生成 state 失败: %w", err)
+	}
+
 	// 获取授权 URL
-	authURL := oauth.GetAuthURL("state")
+	authURL := oauth.GetAuthURL(state)
 	fmt.Println("\n请在浏览器中打开以下链接进行授权：")
 	fmt.Println(authURL)
 	fmt.Println()
@@ -260,15 +266,15 @@ func authorize(oauth *dida.OAuth) error {
 	// 尝试自动打开浏览器
 	openBrowser(authURL)
 
-	fmt.Println("等待授权回调...")
+	logger.Info("等待授权回调...")
 
 	// 启动回调服务器
-	code, err := oauth.StartCallbackServer(ctx)
+	code, err := oauth.StartCallbackServer(ctx, state)
 	if err != nil {
 		return fmt.Errorf("获取授权码失败: %w", err)
 	}
 
-	fmt.Println("收到授权码，正在获取 token...")
+	logger.Info("收到授权码，正在获取 token...")
 
 	// 换取 token
 	_, err = oauth.ExchangeToken(ctx, code)
@@ -276,13 +282,6 @@ func authorize(oauth *dida.OAuth) error {
 		return fmt.Errorf("获取 token 失败: %w", err)
 	}
 
-	// 保存 token
-	if err := oauth.SaveToken(tokenFile); err != nil {
-		fmt.Printf("警告: 保存 token 失败: %v\n", err)
-	} else {
-		fmt.Println("Token 已保存")
-	}
-
 	return nil
 }
 
@@ -300,119 +299,3 @@ func openBrowser(url string) {
 	}
 	cmd.Start()
 }
-
-// extractDidaIDFromPage 从 Notion 页面中提取 TickTick ID
-func extractDidaIDFromPage(page notion.Page) (string, bool) {
-	if didaIDProp, exists := page.Properties["滴答ID"]; exists {
-		if richText, ok := didaIDProp.(map[string]interface{}); ok {
-			if texts, ok := richText["rich_text"].([]interface{}); ok && len(texts) > 0 {
-				if textObj, ok := texts[0].(map[string]interface{}); ok {
-					if textContent, ok := textObj["text"].(map[string]interface{}); ok {
-						if content, ok := textContent["content"].(string); ok {
-							return content, true
-						}
-					}
-				}
-			}
-		}
-	}
-	return "", false
-}
-
-// extractStatusFromPage 从 Notion 页面中提取状态
-func extractStatusFromPage(page notion.Page) (string, bool) {
-	if statusProp, exists := page.Properties["状态"]; exists {
-		if statusObj, ok := statusProp.(map[string]interface{}); ok {
-			if status, ok := statusObj["status"].(map[string]interface{}); ok {
-				if statusName, ok := status["name"].(string); ok {
-					return statusName, true
-				}
-			}
-		}
-	}
-	return "", false
-}
-
-// markCompletedTasks 标记已完成的任务
-// 1. 获取 Notion 数据库中的所有页面
-// 2. 与 TickTick 任务进行比较
-// 3. 如果 Notion 显示任务已完成但 TickTick 中未完成，则更新 TickTick
-// 4. 如果任务在 Notion 中存在但在 TickTick 中不存在（已被删除或完成），则在 Notion 中标记为完成
-func markCompletedTasks(ctx context.Context, notionClient *notion.Client, didaClient *dida.Client, tickTickTasks []dida.Task) int {
-	// 获取 Notion 数据库中的所有页面
-	notionPages, err := notionClient.GetAllPages(ctx)
-	if err != nil {
-		fmt.Printf("获取 Notion 页面失败: %v\n", err)
-		return 0
-	}
-
-	// 创建 TickTick 任务 ID 映射
-	tickTickTaskMap := make(map[string]dida.Task)
-	for _, task := range tickTickTasks {
-		tickTickTaskMap[task.ID] = task
-	}
-
-	// 创建 Notion 中任务的映射
-	notionTaskMap := make(map[string]notion.Page)
-	for _, page := range notionPages {
-		if didaID, exists := extractDidaIDFromPage(page); exists {
-			notionTaskMap[didaID] = page
-		}
-	}
-
-	completedCount := 0
-
-	// 检查 Notion 状态是否需要同步
-	for notionTaskID, notionPage := range notionTaskMap {
-		notionStatus, statusExists := extractStatusFromPage(notionPage)
-		if !statusExists {
-			continue
-		}
-
-		notionCompleted := notionStatus == "完成"
-
-		tickTickTask, existsInTickTick := tickTickTaskMap[notionTaskID]
-		if !existsInTickTick {
-			// 任务在 Notion 中存在但在 TickTick 中不存在
-			// 说明该任务已经在滴答清单中被删除或完成
-			// 在 Notion 中标记该任务为完成
-			if !notionCompleted {
-				props := map[string]interface{}{
-					"状态": map[string]interface{}{
-						"status": map[string]interface{}{
-							"name": "完成",
-						},
-					},
-				}
-				_, err := notionClient.UpdatePage(ctx, notionPage.ID, props)
-				if err != nil {
-					fmt.Printf("在 Notion 中标记完成失败: %s - %v\n", notionPage.ID, err)
-				} else {
-					fmt.Printf("已在 Notion 中标记完成（滴答清单中已不存在）\n")
-					completedCount++
-				}
-				time.Sleep(350 * time.Millisecond)
-			}
-			continue
-		}
-
-		// 同步 Notion 完成状态到 TickTick
-		tickTickCompleted := tickTickTask.Status == 2
-		if notionCompleted && !tickTickCompleted {
-			err := didaClient.UpdateTaskStatus(ctx, tickTickTask.ProjectID, tickTickTask.ID, 2)
-			if err != nil {
-				fmt.Printf("更新 TickTick 任务状态失败: %s - %v\n", tickTickTask.Title, err)
-			} else {
-				fmt.Printf("已同步完成状态到 TickTick: %s\n", tickTickTask.Title)
-				completedCount++
-			}
-		} else if !notionCompleted && tickTickCompleted {
-			// 如果 Notion 中是未完成状态而 TickTick 中已完成，则根据策略决定是否更新
-			// 根据同步策略，可能需要将 TickTick 任务状态改回未完成
-			// 这取决于同步方向策略
-			fmt.Printf("Notion 与 TickTick 状态不一致: %s\n", tickTickTask.Title)
-		}
-	}
-
-	return completedCount
-}
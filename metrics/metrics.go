@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const namespace = "dida_notion_sync"
+
+var (
+	latencyBuckets  = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+)
+
+// Metrics 同步工具暴露的全部指标。所有方法在 nil 接收者上都是空操作，
+// 未启用指标时客户端无需额外判断
+type Metrics struct {
+	Registry *Registry
+
+	apiRequests    *CounterVec
+	apiLatency     *HistogramVec
+	apiRetries     *CounterVec
+	rateLimitWaits *CounterVec
+	rateLimitTime  *CounterVec
+	tasks          *CounterVec
+	conflicts      *CounterVec
+	runs           *CounterVec
+	runDuration    *HistogramVec
+	lastRun        *GaugeVec
+}
+
+// New 创建并注册所有指标
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry: r,
+		apiRequests: r.NewCounter(namespace+"_api_requests_total",
+			"API 请求数，按服务、端点和 HTTP 状态码分组", "service", "endpoint", "status"),
+		apiLatency: r.NewHistogram(namespace+"_api_request_duration_seconds",
+			"API 请求耗时", latencyBuckets, "service", "endpoint"),
+		apiRetries: r.NewCounter(namespace+"_api_retries_total",
+			"因限流或服务端错误而重试的 API 请求数", "service"),
+		rateLimitWaits: r.NewCounter(namespace+"_rate_limit_waits_total",
+			"为避免触发限流而主动等待的次数", "service"),
+		rateLimitTime: r.NewCounter(namespace+"_rate_limit_wait_seconds_total",
+			"为避免触发限流而主动等待的总时长", "service"),
+		tasks: r.NewCounter(namespace+"_tasks_total",
+			"按操作分组的任务数（created, updated, skipped, failed, completed）", "action"),
+		conflicts: r.NewCounter(namespace+"_conflicts_total",
+			"Notion 与滴答清单状态不一致的任务数"),
+		runs: r.NewCounter(namespace+"_runs_total",
+			"同步运行次数，按结果分组", "result"),
+		runDuration: r.NewHistogram(namespace+"_run_duration_seconds",
+			"单次同步运行的耗时", durationBuckets),
+		lastRun: r.NewGauge(namespace+"_last_run_timestamp_seconds",
+			"最近一次同步运行结束的时间戳", "result"),
+	}
+}
+
+// ObserveRequest 记录一次 API 请求；status 为 0 表示请求未得到响应
+func (m *Metrics) ObserveRequest(service, endpoint string, status int, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	statusLabel := "error"
+	if status > 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+	m.apiRequests.With(service, endpoint, statusLabel).Inc()
+	m.apiLatency.With(service, endpoint).Observe(latency.Seconds())
+}
+
+// ObserveRetry 记录一次重试
+func (m *Metrics) ObserveRetry(service string) {
+	if m == nil {
+		return
+	}
+	m.apiRetries.With(service).Inc()
+}
+
+// ObserveRateLimitWait 记录一次主动限流等待
+func (m *Metrics) ObserveRateLimitWait(service string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWaits.With(service).Inc()
+	m.rateLimitTime.With(service).Add(d.Seconds())
+}
+
+// AddTasks 按操作累加任务数
+func (m *Metrics) AddTasks(action string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.tasks.With(action).Add(float64(n))
+}
+
+// IncConflicts 记录一次状态冲突
+func (m *Metrics) IncConflicts() {
+	if m == nil {
+		return
+	}
+	m.conflicts.With().Inc()
+}
+
+// ObserveRun 记录一次同步运行的结果和耗时
+func (m *Metrics) ObserveRun(result string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.runs.With(result).Inc()
+	m.runDuration.With().Observe(d.Seconds())
+	m.lastRun.With(result).Set(float64(time.Now().Unix()))
+}
+
+// EndpointLabel 将请求路径归一化为端点标签，collections 中列出的路径段之后的 ID 替换为 {id}，
+// 例如 /project/abc/task/123 -> /project/{id}/task/{id}
+func EndpointLabel(path string, collections ...string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		for _, c := range collections {
+			if segments[i-1] == c && segments[i] != "" {
+				segments[i] = "{id}"
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,351 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry 指标注册表，按 Prometheus 文本格式输出所有已注册的指标
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric 可以输出为 Prometheus 文本格式的指标族
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounter 注册一个计数器
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: newFamily(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// NewGauge 注册一个仪表
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{family: newFamily(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// NewHistogram 注册一个直方图，buckets 为升序排列的上界
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText 以 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.writeTo(w)
+	}
+}
+
+// Handler 返回提供 /metrics 的 HTTP 处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// Push 将所有指标推送到兼容 Pushgateway 的地址，替换该 job 下已有的指标
+func (r *Registry) Push(ctx context.Context, gatewayURL, job string) error {
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+
+	endpoint := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("push metrics failed: %s, body: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// family 同名指标的公共部分：名称、说明、标签和按标签值分组的子指标
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu       sync.Mutex
+	children map[string]interface{}
+	values   map[string][]string
+}
+
+func newFamily(name, help, typ string, labels []string) family {
+	return family{
+		name:     name,
+		help:     help,
+		typ:      typ,
+		labels:   labels,
+		children: make(map[string]interface{}),
+		values:   make(map[string][]string),
+	}
+}
+
+// child 返回标签值对应的子指标，不存在时用 create 创建
+func (f *family) child(values []string, create func() interface{}) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.children[key]
+	if !ok {
+		c = create()
+		f.children[key] = c
+		f.values[key] = append([]string{}, values...)
+	}
+	return c
+}
+
+// each 按标签值排序遍历所有子指标
+func (f *family) each(fn func(labels string, c interface{})) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for key := range f.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]interface{}, len(keys))
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		children[i] = f.children[key]
+		labels[i] = formatLabels(f.labels, f.values[key])
+	}
+	f.mu.Unlock()
+
+	for i := range keys {
+		fn(labels[i], children[i])
+	}
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+}
+
+// value 并发安全的浮点数值
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	family
+}
+
+// Counter 单个计数器
+type Counter struct {
+	value
+}
+
+// With 返回标签值对应的计数器
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.child(labelValues, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() { c.add(1) }
+
+// Add 计数增加 delta，delta 不能为负
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.add(delta)
+}
+
+func (c *CounterVec) writeTo(w io.Writer) {
+	c.writeHeader(w)
+	c.each(func(labels string, child interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(child.(*Counter).get()))
+	})
+}
+
+// GaugeVec 带标签的仪表
+type GaugeVec struct {
+	family
+}
+
+// Gauge 单个仪表
+type Gauge struct {
+	value
+}
+
+// With 返回标签值对应的仪表
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.child(labelValues, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+// Set 设置仪表的值
+func (g *Gauge) Set(x float64) { g.set(x) }
+
+// Add 仪表的值增加 delta
+func (g *Gauge) Add(delta float64) { g.add(delta) }
+
+func (g *GaugeVec) writeTo(w io.Writer) {
+	g.writeHeader(w)
+	g.each(func(labels string, child interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(child.(*Gauge).get()))
+	})
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// Histogram 单个直方图
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// With 返回标签值对应的直方图
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.child(labelValues, func() interface{} {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *HistogramVec) writeTo(w io.Writer) {
+	h.writeHeader(w)
+	h.each(func(labels string, child interface{}) {
+		hist := child.(*Histogram)
+		hist.mu.Lock()
+		defer hist.mu.Unlock()
+
+		for i, upper := range hist.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", formatFloat(upper)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, hist.count)
+	})
+}
+
+// formatLabels 生成 {a="1",b="2"} 形式的标签字符串
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel 在已格式化的标签字符串中追加一个标签
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+// labelEscaper 按 Prometheus 文本格式转义标签值：只转义反斜杠、双引号和换行，其余字符（包括非 ASCII）原样输出
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTextCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "请求数\n包括重试", "service", "path")
+	c.With("notion", `/v1/"pages"\x`).Add(2)
+	c.With("滴答", "a\nb").Inc()
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	want := `# HELP requests_total 请求数\n包括重试
+# TYPE requests_total counter
+requests_total{service="notion",path="/v1/\"pages\"\\x"} 2
+requests_total{service="滴答",path="a\nb"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteTextGauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("last_run_timestamp", "上次运行时间")
+	g.With().Set(1.5e9)
+	g.With().Add(0.25)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	want := `# HELP last_run_timestamp 上次运行时间
+# TYPE last_run_timestamp gauge
+last_run_timestamp 1.50000000025e+09
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteTextHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "耗时", []float64{0.1, 1}, "service")
+	hist := h.With("dida")
+	for _, v := range []float64{0.05, 0.5, 0.5, 3} {
+		hist.Observe(v)
+	}
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	// 桶计数是累计的，+Inf 桶等于观测总数
+	want := `# HELP latency_seconds 耗时
+# TYPE latency_seconds histogram
+latency_seconds_bucket{service="dida",le="0.1"} 1
+latency_seconds_bucket{service="dida",le="1"} 3
+latency_seconds_bucket{service="dida",le="+Inf"} 4
+latency_seconds_sum{service="dida"} 4.05
+latency_seconds_count{service="dida"} 4
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,298 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxBlocksPerRequest 单次追加子块和分页获取的上限
+const maxBlocksPerRequest = 100
+
+// 块类型
+const (
+	BlockParagraph        = "paragraph"
+	BlockHeading1         = "heading_1"
+	BlockHeading2         = "heading_2"
+	BlockHeading3         = "heading_3"
+	BlockBulletedListItem = "bulleted_list_item"
+	BlockNumberedListItem = "numbered_list_item"
+	BlockToDo             = "to_do"
+	BlockToggle           = "toggle"
+	BlockQuote            = "quote"
+	BlockCallout          = "callout"
+	BlockCode             = "code"
+	BlockDivider          = "divider"
+	BlockChildPage        = "child_page"
+	BlockChildDatabase    = "child_database"
+)
+
+// textBlockTypes 内容为 BlockContent 的块类型；其他类型的内容原样保留
+var textBlockTypes = map[string]bool{
+	BlockParagraph: true, BlockHeading1: true, BlockHeading2: true, BlockHeading3: true,
+	BlockBulletedListItem: true, BlockNumberedListItem: true, BlockToDo: true, BlockToggle: true,
+	BlockQuote: true, BlockCallout: true, BlockCode: true, BlockDivider: true,
+}
+
+// Block Notion 页面内容中的块
+type Block struct {
+	ID             string
+	Type           string
+	CreatedTime    time.Time
+	LastEditedTime time.Time
+	HasChildren    bool
+	Archived       bool
+	Content        BlockContent
+
+	// Children 追加时一并创建的子块；GetBlockChildrenRecursive 返回时填充
+	Children []Block
+
+	// raw 不在 textBlockTypes 中的块内容，更新时原样发送
+	raw json.RawMessage
+}
+
+// BlockContent 文本类块的内容，divider 没有内容
+type BlockContent struct {
+	RichText []RichText
+	Color    string
+	Checked  bool   // to_do
+	Language string // code
+}
+
+// blockContentJSON BlockContent 的 JSON 格式
+type blockContentJSON struct {
+	RichText []RichText `json:"rich_text"`
+	Color    string     `json:"color,omitempty"`
+	Checked  *bool      `json:"checked,omitempty"`
+	Language string     `json:"language,omitempty"`
+	Children []Block    `json:"children,omitempty"`
+}
+
+// NewTextBlock 只有一段纯文本的块，如段落、标题、列表项
+func NewTextBlock(blockType, content string) Block {
+	return Block{Type: blockType, Content: BlockContent{RichText: NewRichTextList(content)}}
+}
+
+// NewToDoBlock 待办块
+func NewToDoBlock(content string, checked bool) Block {
+	b := NewTextBlock(BlockToDo, content)
+	b.Content.Checked = checked
+	return b
+}
+
+// PlainText 块文本的纯文本
+func (b Block) PlainText() string {
+	return richTextPlain(b.Content.RichText)
+}
+
+// content 块内容的请求格式，withChildren 为 false 时不包含子块
+func (b Block) content(withChildren bool) (interface{}, error) {
+	if !textBlockTypes[b.Type] {
+		if b.raw == nil {
+			return nil, fmt.Errorf("unsupported block type %q", b.Type)
+		}
+		return b.raw, nil
+	}
+	if b.Type == BlockDivider {
+		return struct{}{}, nil
+	}
+	c := blockContentJSON{
+		RichText: nonNilRichText(b.Content.RichText),
+		Color:    b.Content.Color,
+		Language: b.Content.Language,
+	}
+	if b.Type == BlockToDo {
+		c.Checked = &b.Content.Checked
+	}
+	if b.Type == BlockCode && c.Language == "" {
+		c.Language = "plain text"
+	}
+	if withChildren {
+		c.Children = b.Children
+	}
+	return c, nil
+}
+
+// MarshalJSON 按请求格式输出：{"object":"block","type":"<type>","<type>":内容}，子块放在内容的 children 中
+func (b Block) MarshalJSON() ([]byte, error) {
+	content, err := b.content(true)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{"object": "block", "type": b.Type, b.Type: content})
+}
+
+// UnmarshalJSON 解析响应格式的块
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		ID             string    `json:"id"`
+		Type           string    `json:"type"`
+		CreatedTime    time.Time `json:"created_time"`
+		LastEditedTime time.Time `json:"last_edited_time"`
+		HasChildren    bool      `json:"has_children"`
+		Archived       bool      `json:"archived"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*b = Block{
+		ID:             aux.ID,
+		Type:           aux.Type,
+		CreatedTime:    aux.CreatedTime,
+		LastEditedTime: aux.LastEditedTime,
+		HasChildren:    aux.HasChildren,
+		Archived:       aux.Archived,
+	}
+	content, ok := raw[aux.Type]
+	if !ok {
+		return nil
+	}
+	if !textBlockTypes[aux.Type] {
+		b.raw = content
+		return nil
+	}
+	var c blockContentJSON
+	if err := json.Unmarshal(content, &c); err != nil {
+		return fmt.Errorf("block type %s: %w", aux.Type, err)
+	}
+	b.Content = BlockContent{RichText: c.RichText, Color: c.Color, Language: c.Language}
+	if c.Checked != nil {
+		b.Content.Checked = *c.Checked
+	}
+	b.Children = c.Children
+	return nil
+}
+
+// blockList 子块列表响应
+type blockList struct {
+	Results    []Block `json:"results"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// GetBlock 获取单个块
+func (c *Client) GetBlock(ctx context.Context, blockID string) (*Block, error) {
+	var result Block
+	if err := c.doRequest(ctx, "GET", "/blocks/"+blockID, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetBlockChildren 分页获取块（或页面）的所有直接子块
+func (c *Client) GetBlockChildren(ctx context.Context, blockID string) ([]Block, error) {
+	var blocks []Block
+	var cursor string
+
+	for {
+		query := url.Values{}
+		query.Set("page_size", strconv.Itoa(maxBlocksPerRequest))
+		if cursor != "" {
+			query.Set("start_cursor", cursor)
+		}
+
+		var result blockList
+		path := fmt.Sprintf("/blocks/%s/children?%s", blockID, query.Encode())
+		if err := c.doRequest(ctx, "GET", path, nil, &result); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, result.Results...)
+
+		if !result.HasMore || result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	return blocks, nil
+}
+
+// GetBlockChildrenRecursive 获取所有子块，并递归填充有子块的块的 Children。
+// 子页面和子数据库是独立的页面，不获取其内容
+func (c *Client) GetBlockChildrenRecursive(ctx context.Context, blockID string) ([]Block, error) {
+	blocks, err := c.GetBlockChildren(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		if !b.HasChildren || b.Type == BlockChildPage || b.Type == BlockChildDatabase {
+			continue
+		}
+		if b.Children, err = c.GetBlockChildrenRecursive(ctx, b.ID); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// AppendBlockChildren 在块（或页面）末尾追加子块，返回新建的直接子块。
+// 每次请求最多追加 100 个块，超出时分批发送；子块的 Children 在父块创建后逐层追加，
+// 不受 API 单次请求两层嵌套的限制。追加不是幂等的，只在限流时重试，服务端错误直接返回
+func (c *Client) AppendBlockChildren(ctx context.Context, blockID string, blocks []Block) ([]Block, error) {
+	var created []Block
+	path := fmt.Sprintf("/blocks/%s/children", blockID)
+
+	for start := 0; start < len(blocks); start += maxBlocksPerRequest {
+		end := start + maxBlocksPerRequest
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		batch := make([]Block, end-start)
+		for i, b := range blocks[start:end] {
+			b.Children = nil
+			batch[i] = b
+		}
+
+		var result blockList
+		if err := c.doRequestRetrying(ctx, "PATCH", path, map[string]interface{}{"children": batch}, &result, isRateLimited); err != nil {
+			return created, err
+		}
+		if len(result.Results) != len(batch) {
+			return created, fmt.Errorf("appended %d blocks, got %d in response", len(batch), len(result.Results))
+		}
+
+		for i, b := range blocks[start:end] {
+			block := result.Results[i]
+			if len(b.Children) > 0 {
+				children, err := c.AppendBlockChildren(ctx, block.ID, b.Children)
+				block.Children = children
+				block.HasChildren = true
+				if err != nil {
+					return append(created, block), err
+				}
+			}
+			created = append(created, block)
+		}
+	}
+
+	return created, nil
+}
+
+// UpdateBlock 更新块的内容，块类型不能修改；Children 不会被更新
+func (c *Client) UpdateBlock(ctx context.Context, block Block) (*Block, error) {
+	content, err := block.content(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Block
+	body := map[string]interface{}{block.Type: content}
+	if err := c.doRequest(ctx, "PATCH", "/blocks/"+block.ID, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteBlock 删除（归档）块，其子块一并删除
+func (c *Client) DeleteBlock(ctx context.Context, blockID string) error {
+	return c.doRequest(ctx, "DELETE", "/blocks/"+blockID, nil, nil)
+}
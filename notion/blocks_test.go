@@ -0,0 +1,170 @@
+package notion_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dida-to-notion-sync/internal/fault"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/notion/notiontest"
+)
+
+// countRequests 统计以 prefix 开头的请求数
+func countRequests(srv *notiontest.Server, prefix string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// TestBlocksAppendInBatchesAndReadRecursively 超过 100 个块分批追加，三层嵌套的子块逐层创建后能递归读回
+func TestBlocksAppendInBatchesAndReadRecursively(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	client := srv.NewClient("database-id")
+	ctx := context.Background()
+	pageID := srv.AddPage("database-id", notion.Properties{"名称": notion.NewTitle("页面")})
+
+	blocks := make([]notion.Block, 250)
+	for i := range blocks {
+		blocks[i] = notion.NewTextBlock(notion.BlockParagraph, fmt.Sprintf("段落 %d", i))
+	}
+	list := notion.NewTextBlock(notion.BlockBulletedListItem, "第一层")
+	item := notion.NewToDoBlock("第二层", true)
+	item.Children = []notion.Block{notion.NewTextBlock(notion.BlockParagraph, "第三层")}
+	list.Children = []notion.Block{item}
+	blocks[10] = list
+	blocks = append(blocks, notion.Block{Type: notion.BlockDivider})
+
+	created, err := client.AppendBlockChildren(ctx, pageID, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != len(blocks) {
+		t.Fatalf("created %d blocks, want %d", len(created), len(blocks))
+	}
+	// 顶层 251 个块分 3 批，再加两层嵌套各一次
+	if n := countRequests(srv, "PATCH /v1/blocks/"); n != 5 {
+		t.Errorf("append requests = %d, want 5", n)
+	}
+
+	got, err := client.GetBlockChildrenRecursive(ctx, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(blocks) || got[0].PlainText() != "段落 0" || got[250].Type != notion.BlockDivider {
+		t.Fatalf("got %d blocks", len(got))
+	}
+	first := got[10]
+	if !first.HasChildren || len(first.Children) != 1 {
+		t.Fatalf("nested block = %+v", first)
+	}
+	second := first.Children[0]
+	if second.Type != notion.BlockToDo || !second.Content.Checked || second.PlainText() != "第二层" {
+		t.Errorf("second level = %+v", second)
+	}
+	if len(second.Children) != 1 || second.Children[0].PlainText() != "第三层" {
+		t.Errorf("third level = %+v", second.Children)
+	}
+}
+
+func TestBlocksUpdateAndDelete(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	client := srv.NewClient("database-id")
+	ctx := context.Background()
+	pageID := srv.AddPage("database-id", notion.Properties{"名称": notion.NewTitle("页面")})
+
+	created, err := client.AppendBlockChildren(ctx, pageID, []notion.Block{
+		notion.NewToDoBlock("写周报", false),
+		notion.NewTextBlock(notion.BlockParagraph, "将被删除"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	todo := created[0]
+	todo.Content.Checked = true
+	todo.Content.RichText = notion.NewRichTextList("写周报（已完成）")
+	updated, err := client.UpdateBlock(ctx, todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.Content.Checked || updated.PlainText() != "写周报（已完成）" {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	if err := client.DeleteBlock(ctx, created[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Archived(created[1].ID) {
+		t.Error("block not archived")
+	}
+	children, err := client.GetBlockChildren(ctx, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].ID != todo.ID || !children[0].Content.Checked {
+		t.Errorf("children = %+v", children)
+	}
+
+	block, err := client.GetBlock(ctx, todo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.PlainText() != "写周报（已完成）" {
+		t.Errorf("GetBlock = %+v", block)
+	}
+}
+
+// TestBlocksAppendDoesNotRetryServerErrors 服务端错误时追加可能已经生效，重试会写入重复的块
+func TestBlocksAppendDoesNotRetryServerErrors(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	client := srv.NewClient("database-id")
+	pageID := srv.AddPage("database-id", notion.Properties{"名称": notion.NewTitle("页面")})
+
+	srv.InjectFault(fault.Fault{Method: "PATCH", Path: "/v1/blocks/", Status: http.StatusBadGateway, Times: 1, Applied: true})
+	if _, err := client.AppendBlockChildren(context.Background(), pageID, []notion.Block{
+		notion.NewTextBlock(notion.BlockParagraph, "描述"),
+	}); err == nil {
+		t.Fatal("AppendBlockChildren succeeded, want server error")
+	}
+	if n := len(srv.Children(pageID)); n != 1 {
+		t.Errorf("page has %d blocks, want 1", n)
+	}
+
+	// 限流时请求没有被执行，仍然重试
+	srv.InjectFault(fault.Fault{Method: "PATCH", Path: "/v1/blocks/", Status: http.StatusTooManyRequests, Times: 1})
+	if _, err := client.AppendBlockChildren(context.Background(), pageID, []notion.Block{
+		notion.NewTextBlock(notion.BlockParagraph, "清单"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Children(pageID)); n != 2 {
+		t.Errorf("page has %d blocks, want 2", n)
+	}
+}
+
+// TestBlocksGetChildrenStopsWithoutCursor has_more 为 true 但没有 next_cursor 时停止分页
+func TestBlocksGetChildrenStopsWithoutCursor(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	client := srv.NewClient("database-id")
+	pageID := srv.AddPage("database-id", notion.Properties{"名称": notion.NewTitle("页面")})
+
+	srv.InjectFault(fault.Fault{Method: "GET", Path: "/v1/blocks/", Status: http.StatusOK, Times: 3,
+		Body: `{"object":"list","results":[],"has_more":true,"next_cursor":null}`})
+	if _, err := client.GetBlockChildren(context.Background(), pageID); err != nil {
+		t.Fatal(err)
+	}
+	if n := client.Stats().Requests; n != 1 {
+		t.Errorf("list requests = %d, want 1", n)
+	}
+}
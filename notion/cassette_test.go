@@ -0,0 +1,103 @@
+package notion_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"dida-to-notion-sync/cassette"
+	"dida-to-notion-sync/notion"
+)
+
+// testdata 中的 cassette 是按 API 文档手写的固定数据，不是真实录制。用真实数据库录制替换：
+// CASSETTE_RECORD=1 NOTION_TOKEN=... NOTION_DATABASE_ID=... go test ./notion -run Cassette
+// 数据库至少需要有一个设置了 滴答ID 的页面。标题、文本和页面链接在写入文件前被替换为占位符，
+// 数据库 ID 替换为 database-id
+
+// cassetteDatabaseID cassette 文件中的数据库 ID
+const cassetteDatabaseID = "database-id"
+
+// didaIDPattern 滴答ID 的格式（可带账号前缀），不需要脱敏
+var didaIDPattern = regexp.MustCompile(`^([a-z0-9_-]+:)?[0-9a-f]{24}$`)
+
+// newCassetteClient 创建使用 testdata/<name>.json 录制或回放请求的客户端
+func newCassetteClient(t *testing.T, name string) (*notion.Client, *cassette.Recorder) {
+	t.Helper()
+	mode := cassette.ModeFromEnv()
+
+	token, databaseID := "cassette-token", cassetteDatabaseID
+	if mode == cassette.Record {
+		token, databaseID = os.Getenv("NOTION_TOKEN"), os.Getenv("NOTION_DATABASE_ID")
+		if token == "" || databaseID == "" {
+			t.Skip("录制需要设置 NOTION_TOKEN 和 NOTION_DATABASE_ID")
+		}
+	}
+
+	rec, err := cassette.New(filepath.Join("testdata", name+".json"), mode,
+		cassette.WithScrubKeys("plain_text", "content", "url", "email"),
+		cassette.WithKeep(didaIDPattern),
+		cassette.WithReplacement(databaseID, cassetteDatabaseID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notion.NewClient(token, databaseID, notion.WithHTTPClient(rec.Client())), rec
+}
+
+// didaID 页面的 滴答ID 属性值
+func didaID(page notion.Page) string {
+	id, _ := page.Text("滴答ID")
+	return id
+}
+
+// TestCassetteQueryDatabase 分页查询所有页面，再按其中一个页面的 滴答ID 查找
+func TestCassetteQueryDatabase(t *testing.T) {
+	client, rec := newCassetteClient(t, "query_database")
+	defer func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+	ctx := context.Background()
+
+	pages, err := client.GetAllPages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var target notion.Page
+	for _, page := range pages {
+		if page.ID == "" || page.LastEditedTime.IsZero() {
+			t.Errorf("page missing id or last_edited_time: %+v", page)
+		}
+		if target.ID == "" && didaID(page) != "" {
+			target = page
+		}
+	}
+	if target.ID == "" {
+		t.Fatal("no page with 滴答ID")
+	}
+
+	found, err := client.FindPageByDidaID(ctx, didaID(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.ID != target.ID {
+		t.Errorf("FindPageByDidaID(%s) = %+v, want page %s", didaID(target), found, target.ID)
+	}
+
+	if rec.Mode() != cassette.Replay {
+		return
+	}
+	// cassette 中的查询返回了两页结果
+	if len(pages) != 3 {
+		t.Errorf("got %d pages, want 3", len(pages))
+	}
+	if remaining := rec.Remaining(); len(remaining) != 0 {
+		t.Errorf("requests not made: %v", remaining)
+	}
+	if status, _ := pages[1].Status("状态"); status != "完成" {
+		t.Errorf("状态 = %q, want 完成", status)
+	}
+}
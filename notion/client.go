@@ -4,101 +4,219 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/metrics"
 )
 
 const (
-	baseURL       = "https://api.notion.com/v1"
-	notionVersion = "2022-06-28"
+	// DefaultBaseURL Notion API 地址
+	DefaultBaseURL = "https://api.notion.com/v1"
+
+	notionVersion    = "2022-06-28"
+	maxRetries       = 3
+	defaultUserAgent = "dida-to-notion-sync"
 )
 
 // Client Notion API 客户端
 type Client struct {
 	token      string
 	databaseID string
+	baseURL    string
+	userAgent  string
+	timeout    time.Duration
 	httpClient *http.Client
+	clock      clock.Clock
+	stats      Stats
+	log        *logging.Logger
+	metrics    *metrics.Metrics
+
+	archiveDuplicates bool
+}
+
+// Stats API 调用统计
+type Stats struct {
+	Requests int64 // 发出的 HTTP 请求数（含重试）
+	Errors   int64 // 最终失败的请求数
+	Retries  int64 // 因限流或服务端错误而重试的次数
 }
 
 // NewClient 创建新的 Notion 客户端
-func NewClient(token, databaseID string) *Client {
-	return &Client{
+func NewClient(token, databaseID string, opts ...Option) *Client {
+	c := &Client{
 		token:      token,
 		databaseID: databaseID,
+		baseURL:    DefaultBaseURL,
+		userAgent:  defaultUserAgent,
 		httpClient: http.DefaultClient,
+		clock:      clock.Real(),
+		log:        logging.Nop(),
 	}
+	c.applyOptions(opts)
+	return c
+}
+
+// APIError Notion API 返回的错误响应
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Notion API error: %s, body: %s", e.Status, e.Body)
 }
 
-// doRequest 执行 API 请求
+// IsUnauthorized 判断错误是否由 Notion token 无效引起
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// Stats 返回当前的 API 调用统计
+func (c *Client) Stats() Stats {
+	return Stats{
+		Requests: atomic.LoadInt64(&c.stats.Requests),
+		Errors:   atomic.LoadInt64(&c.stats.Errors),
+		Retries:  atomic.LoadInt64(&c.stats.Retries),
+	}
+}
+
+// doRequest 执行 API 请求，遇到限流或服务端错误时自动重试
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, result interface{}) error {
-	var reqBody io.Reader
+	return c.doRequestRetrying(ctx, method, path, body, result, shouldRetry)
+}
+
+// doRequestRetrying 执行 API 请求，retryable 返回 true 的状态码自动重试
+func (c *Client) doRequestRetrying(ctx context.Context, method, path string, body interface{}, result interface{}, retryable func(int) bool) error {
+	err := c.doRequestWithRetry(ctx, method, path, body, result, retryable)
+	if err != nil {
+		atomic.AddInt64(&c.stats.Errors, 1)
+	}
+	return err
+}
+
+func (c *Client) doRequestWithRetry(ctx context.Context, method, path string, body interface{}, result interface{}, retryable func(int) bool) error {
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return err
 		}
-		reqBody = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, reqBody)
-	if err != nil {
-		return err
-	}
+	endpoint := method + " " + metrics.EndpointLabel(path, "databases", "pages", "blocks")
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if jsonBody != nil {
+			reqBody = bytes.NewReader(jsonBody)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+		if err != nil {
+			return err
+		}
 
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Notion-Version", notionVersion)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Notion-Version", notionVersion)
+		req.Header.Set("User-Agent", c.userAgent)
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+		atomic.AddInt64(&c.stats.Requests, 1)
+		start := c.clock.Now()
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			c.metrics.ObserveRequest("notion", endpoint, 0, c.clock.Now().Sub(start))
+			c.log.Debug("Notion 请求失败", "method", method, "path", path, "error", err)
+			return err
+		}
+
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		latency := c.clock.Now().Sub(start)
+		c.metrics.ObserveRequest("notion", endpoint, resp.StatusCode, latency)
+		c.log.Debug("Notion 请求", "method", method, "path", path,
+			"status", resp.StatusCode, "latency_ms", latency.Milliseconds())
 
-	respBody, _ := ioutil.ReadAll(resp.Body)
+		if retryable(resp.StatusCode) && attempt < maxRetries {
+			wait := retryDelay(resp, attempt)
+			atomic.AddInt64(&c.stats.Retries, 1)
+			c.metrics.ObserveRetry("notion")
+			c.log.Warn(fmt.Sprintf("Notion API 返回 %s，%v 后重试", resp.Status, wait),
+				"method", method, "path", path, "status", resp.StatusCode, "attempt", attempt+1)
+			if err := c.clock.Sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+		}
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("Notion API error: %s, body: %s", resp.Status, string(respBody))
+		if result != nil {
+			return json.Unmarshal(respBody, result)
+		}
+		return nil
 	}
+}
+
+// shouldRetry 判断该状态码是否值得重试
+func shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// isRateLimited 只重试限流：被限流的请求没有被执行，服务端错误时请求可能已经生效
+func isRateLimited(status int) bool {
+	return status == http.StatusTooManyRequests
+}
 
-	if result != nil {
-		return json.Unmarshal(respBody, result)
+// retryDelay 计算重试等待时间，优先使用 Retry-After 头
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
 	}
-	return nil
+	return time.Duration(1<<uint(attempt)) * 500 * time.Millisecond
 }
 
 // Page Notion 页面
 type Page struct {
-	ID         string                 `json:"id"`
-	Properties map[string]interface{} `json:"properties"`
+	ID             string     `json:"id"`
+	CreatedTime    time.Time  `json:"created_time"`
+	LastEditedTime time.Time  `json:"last_edited_time"`
+	Archived       bool       `json:"archived"`
+	Parent         PageParent `json:"parent"`
+	Properties     Properties `json:"properties"`
 }
 
-// QueryResponse 查询响应
-type QueryResponse struct {
-	Results    []Page `json:"results"`
-	HasMore    bool   `json:"has_more"`
-	NextCursor string `json:"next_cursor,omitempty"`
+// PageParent 页面的上级，数据库中的页面 Type 为 database_id
+type PageParent struct {
+	Type       string `json:"type"`
+	DatabaseID string `json:"database_id,omitempty"`
 }
 
-// QueryDatabase 查询数据库
-func (c *Client) QueryDatabase(ctx context.Context, filter map[string]interface{}) (*QueryResponse, error) {
-	var result QueryResponse
-	body := map[string]interface{}{}
-	if filter != nil {
-		body["filter"] = filter
-	}
+// InDatabase 判断页面是否属于 databaseID 对应的数据库，忽略 ID 中的连字符和大小写
+func (p *Page) InDatabase(databaseID string) bool {
+	return p.Parent.DatabaseID != "" && normalizeID(p.Parent.DatabaseID) == normalizeID(databaseID)
+}
 
-	path := fmt.Sprintf("/databases/%s/query", c.databaseID)
-	if err := c.doRequest(ctx, "POST", path, body, &result); err != nil {
-		return nil, err
-	}
-	return &result, nil
+func normalizeID(id string) string {
+	return strings.ToLower(strings.Replace(id, "-", "", -1))
 }
 
 // CreatePage 创建页面
-func (c *Client) CreatePage(ctx context.Context, properties map[string]interface{}) (*Page, error) {
+func (c *Client) CreatePage(ctx context.Context, properties Properties) (*Page, error) {
 	body := map[string]interface{}{
 		"parent": map[string]interface{}{
 			"database_id": c.databaseID,
@@ -114,7 +232,7 @@ func (c *Client) CreatePage(ctx context.Context, properties map[string]interface
 }
 
 // UpdatePage 更新页面
-func (c *Client) UpdatePage(ctx context.Context, pageID string, properties map[string]interface{}) (*Page, error) {
+func (c *Client) UpdatePage(ctx context.Context, pageID string, properties Properties) (*Page, error) {
 	body := map[string]interface{}{
 		"properties": properties,
 	}
@@ -127,50 +245,19 @@ func (c *Client) UpdatePage(ctx context.Context, pageID string, properties map[s
 	return &result, nil
 }
 
-// FindPageByDidaID 通过滴答ID查找页面
-func (c *Client) FindPageByDidaID(ctx context.Context, didaID string) (*Page, error) {
-	filter := map[string]interface{}{
-		"property": "滴答ID",
-		"rich_text": map[string]interface{}{
-			"equals": didaID,
-		},
-	}
-
-	result, err := c.QueryDatabase(ctx, filter)
-	if err != nil {
+// GetPage 获取单个页面
+func (c *Client) GetPage(ctx context.Context, pageID string) (*Page, error) {
+	var result Page
+	path := fmt.Sprintf("/pages/%s", pageID)
+	if err := c.doRequest(ctx, "GET", path, nil, &result); err != nil {
 		return nil, err
 	}
-
-	if len(result.Results) > 0 {
-		return &result.Results[0], nil
-	}
-	return nil, nil
+	return &result, nil
 }
 
-// GetAllPages 获取数据库中所有页面
-func (c *Client) GetAllPages(ctx context.Context) ([]Page, error) {
-	var allPages []Page
-	var cursor string
-
-	for {
-		body := map[string]interface{}{}
-		if cursor != "" {
-			body["start_cursor"] = cursor
-		}
-
-		var result QueryResponse
-		path := fmt.Sprintf("/databases/%s/query", c.databaseID)
-		if err := c.doRequest(ctx, "POST", path, body, &result); err != nil {
-			return nil, err
-		}
-
-		allPages = append(allPages, result.Results...)
-
-		if !result.HasMore {
-			break
-		}
-		cursor = result.NextCursor
-	}
-
-	return allPages, nil
+// ArchivePage 归档（删除）页面
+func (c *Client) ArchivePage(ctx context.Context, pageID string) error {
+	body := map[string]interface{}{"archived": true}
+	path := fmt.Sprintf("/pages/%s", pageID)
+	return c.doRequest(ctx, "PATCH", path, body, nil)
 }
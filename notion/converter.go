@@ -6,74 +6,38 @@ import (
 
 // TaskToProperties 将滴答清单任务转换为 Notion 属性
 // 根据你的数据库结构：名称(title), 状态(status), 日期(date), 项目(select), 标签(select), 描述(rich_text), 滴答ID(rich_text)
-func TaskToProperties(task dida.Task, projectName string, parentTaskTitle string) map[string]interface{} {
-	props := map[string]interface{}{
-		// 名称 (Title)
-		"名称": map[string]interface{}{
-			"title": []map[string]interface{}{
-				{
-					"text": map[string]interface{}{
-						"content": task.Title,
-					},
-				},
-			},
-		},
-		// 滴答ID (rich_text) - 用于去重
-		"滴答ID": map[string]interface{}{
-			"rich_text": []map[string]interface{}{
-				{
-					"text": map[string]interface{}{
-						"content": task.ID,
-					},
-				},
-			},
-		},
-		// 状态 (status) - Notion 的 status 类型需要用 name
-		"状态": map[string]interface{}{
-			"status": map[string]interface{}{
-				"name": statusToName(task.Status),
-			},
-		},
-		// 项目 (Select)
-		"项目": map[string]interface{}{
-			"select": map[string]interface{}{
-				"name": projectName,
-			},
-		},
+func TaskToProperties(task dida.Task, projectName string, parentTaskTitle string) Properties {
+	props := Properties{
+		"名称":   NewTitle(task.Title),
+		"滴答ID": DidaIDProperty(task.ID), // 用于去重
+		"状态":   NewStatus(statusToName(task.Status)),
+		"项目":   NewSelect(projectName),
+		"标签":   NewSelect(priorityToLabel(task.Priority)), // 使用优先级作为标签
 	}
 
 	// 日期 (Date) - 截止日期
 	if task.DueDate != "" {
-		props["日期"] = map[string]interface{}{
-			"date": map[string]interface{}{
-				"start": formatDate(task.DueDate),
-			},
-		}
-	}
-
-	// 标签 (Select) - 使用优先级作为标签
-	props["标签"] = map[string]interface{}{
-		"select": map[string]interface{}{
-			"name": priorityToLabel(task.Priority),
-		},
+		props["日期"] = NewDate(formatDate(task.DueDate))
 	}
 
 	// 描述 (rich_text)
 	if task.Content != "" {
-		props["描述"] = map[string]interface{}{
-			"rich_text": []map[string]interface{}{
-				{
-					"text": map[string]interface{}{
-						"content": truncateString(task.Content, 2000),
-					},
-				},
-			},
-		}
+		props["描述"] = NewRichText(truncateString(task.Content, 2000))
 	}
 
 	return props
 }
 
+// DidaIDProperty 滴答ID 属性值（rich_text）
+func DidaIDProperty(id string) PropertyValue {
+	return NewRichText(id)
+}
+
+// OwnerProperty 负责人属性值（select），多账号同步到同一数据库时区分任务来自哪个账号
+func OwnerProperty(owner string) PropertyValue {
+	return NewSelect(owner)
+}
+
 // statusToName 状态转换
 func statusToName(status int) string {
 	if status == 2 {
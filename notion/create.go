@@ -0,0 +1,81 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// consistencyChecks 等待新页面出现在查询结果中时的查询次数
+	consistencyChecks = 3
+
+	// consistencyDelay 查询之间的间隔；新建的页面通常要几秒后才能被数据库查询到
+	consistencyDelay = 2 * time.Second
+)
+
+// MayHaveSucceeded 判断失败的请求是否可能已经生效：网络错误、超时和服务端错误时服务端可能已处理了请求，
+// 4xx 错误（包括限流）表示请求被拒绝
+func MayHaveSucceeded(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// WaitForPageByDidaID 按滴答ID 查找页面，找不到时等待后重新查询，最多查询 3 次。
+// 用于确认之前可能已成功的创建请求，避免刚创建的页面因查询延迟而被重复创建
+func (c *Client) WaitForPageByDidaID(ctx context.Context, didaID string) (*Page, error) {
+	for check := 0; ; check++ {
+		page, err := c.FindPageByDidaID(ctx, didaID)
+		if err != nil || page != nil || check == consistencyChecks-1 {
+			return page, err
+		}
+		if err := c.clock.Sleep(ctx, consistencyDelay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CreatePageForDidaID 创建滴答ID 为 didaID 的页面。创建请求不会被直接重发：
+// 请求可能已生效时（见 MayHaveSucceeded）先等待并按滴答ID 查找，找到则返回已有的页面，
+// 找不到才重新创建，最多重试 3 次
+func (c *Client) CreatePageForDidaID(ctx context.Context, didaID string, properties Properties) (*Page, error) {
+	body := map[string]interface{}{
+		"parent": map[string]interface{}{
+			"database_id": c.databaseID,
+		},
+		"properties": properties,
+	}
+
+	for attempt := 0; ; attempt++ {
+		var result Page
+		err := c.doRequestRetrying(ctx, "POST", "/pages", body, &result, isRateLimited)
+		if err == nil {
+			return &result, nil
+		}
+		if !MayHaveSucceeded(err) || attempt >= maxRetries {
+			return nil, err
+		}
+
+		atomic.AddInt64(&c.stats.Retries, 1)
+		c.metrics.ObserveRetry("notion")
+		c.log.Warn("创建页面的结果未知，确认页面是否已创建",
+			"task_id", didaID, "attempt", attempt+1, "error", err)
+		page, findErr := c.WaitForPageByDidaID(ctx, didaID)
+		if findErr != nil {
+			return nil, fmt.Errorf("%v; 确认页面是否已创建失败: %w", err, findErr)
+		}
+		if page != nil {
+			c.log.Info("页面已创建，使用已有页面", "task_id", didaID, "page_id", page.ID)
+			return page, nil
+		}
+	}
+}
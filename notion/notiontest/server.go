@@ -0,0 +1,1075 @@
+// Package notiontest 提供内存中的 Notion API 假服务器，用于端到端测试。
+//
+// 实现了客户端用到的接口：数据库查询（过滤、排序、分页）、页面的创建/读取/更新，
+// 以及块的读取、追加、更新和删除。返回的数据与真实 API 同构：属性带 type 字段，
+// 文本带 plain_text，last_edited_time 精确到分钟。不校验数据库结构，
+// 双向关联需要用 SetDualRelation 声明
+package notiontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/internal/fault"
+	"dida-to-notion-sync/notion"
+)
+
+// Token 假服务器接受的 integration token
+const Token = "notiontest-token"
+
+// maxPageSize 分页和追加子块的上限，与真实 API 一致
+const maxPageSize = 100
+
+// Server Notion 假服务器
+type Server struct {
+	// URL 服务器根地址，API 地址为 URL + "/v1"
+	URL string
+
+	srv    *httptest.Server
+	faults fault.Injector
+
+	mu       sync.Mutex
+	clock    clock.Clock
+	queryLag time.Duration
+	duals    map[string]string            // 双向关联的属性名 -> 另一侧的属性名
+	schemas  map[string]map[string]string // 数据库 ID -> 属性名 -> 类型
+	fixed    map[string]bool              // 属性已由 SetSchema 固定的数据库
+	nextID   int
+	pages    map[string]*page
+	order    []string // 页面按创建顺序返回
+	blocks   map[string]*block
+	children map[string][]string // 页面或块 ID -> 子块 ID
+	requests []string
+}
+
+type page struct {
+	id         string
+	databaseID string
+	created    time.Time
+	edited     time.Time
+	indexed    time.Time // 从该时间起出现在查询结果中
+	archived   bool
+	properties map[string]interface{}
+}
+
+type block struct {
+	id         string
+	parentID   string
+	parentType string // page_id 或 block_id
+	typ        string
+	content    map[string]interface{}
+	created    time.Time
+	edited     time.Time
+	archived   bool
+}
+
+// NewServer 启动假服务器，用完后调用 Close
+func NewServer() *Server {
+	s := &Server{
+		clock:    clock.Real(),
+		pages:    make(map[string]*page),
+		duals:    make(map[string]string),
+		schemas:  make(map[string]map[string]string),
+		fixed:    make(map[string]bool),
+		blocks:   make(map[string]*block),
+		children: make(map[string][]string),
+	}
+	s.srv = httptest.NewServer(s.faults.Wrap(http.HandlerFunc(s.handle)))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close 关闭服务器
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetClock 设置生成 created_time 和 last_edited_time 使用的时钟
+func (s *Server) SetClock(clk clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clk
+}
+
+// SetQueryLag 设置新页面出现在数据库查询结果中的延迟，模拟真实 API 的索引延迟；
+// 按 ID 获取页面不受影响
+func (s *Server) SetQueryLag(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queryLag = d
+}
+
+// SetDualRelation 把关联属性 a 和 b 设为双向关联：页面 X 的 a 关联页面 Y 时，
+// Y 的 b 自动关联 X，移除关联时同样同步，与 Notion 数据库中的双向关联属性一致
+func (s *Server) SetDualRelation(a, b string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.duals[a] = b
+	s.duals[b] = a
+}
+
+// SetSchema 固定数据库的属性（属性名 -> 类型），之后写入其他属性的请求返回 400，与真实数据库一致。
+// 未设置时数据库的属性为页面写入过的所有属性。页面响应总是包含数据库的所有属性，未设置的为空值
+func (s *Server) SetSchema(databaseID string, properties map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schema := make(map[string]string, len(properties))
+	for name, typ := range properties {
+		schema[name] = typ
+	}
+	s.schemas[databaseID] = schema
+	s.fixed[databaseID] = true
+}
+
+// NewClient 创建指向假服务器的客户端
+func (s *Server) NewClient(databaseID string, opts ...notion.Option) *notion.Client {
+	opts = append([]notion.Option{notion.WithBaseURL(s.URL + "/v1")}, opts...)
+	return notion.NewClient(Token, databaseID, opts...)
+}
+
+// InjectFault 添加故障规则，Path 为相对于服务器根地址的路径前缀（如 /v1/pages）
+func (s *Server) InjectFault(f fault.Fault) {
+	s.faults.Add(f)
+}
+
+// ResetFaults 清除所有故障规则
+func (s *Server) ResetFaults() {
+	s.faults.Reset()
+}
+
+// AddPage 直接在数据库中创建页面，返回页面 ID；properties 与 CreatePage 的参数格式相同
+func (s *Server) AddPage(databaseID string, properties notion.Properties) string {
+	var props map[string]interface{}
+	roundTrip(properties, &props)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.createPage(databaseID, props)
+	if err != nil {
+		panic(err)
+	}
+	return p.id
+}
+
+// Pages 返回数据库中未归档的页面，按创建顺序排列
+func (s *Server) Pages(databaseID string) []notion.Page {
+	s.mu.Lock()
+	var raw []map[string]interface{}
+	for _, id := range s.order {
+		p := s.pages[id]
+		if p.databaseID == databaseID && !p.archived {
+			raw = append(raw, s.pageJSON(p))
+		}
+	}
+	s.mu.Unlock()
+
+	var pages []notion.Page
+	roundTrip(raw, &pages)
+	return pages
+}
+
+// Page 返回页面（包括已归档的页面）
+func (s *Server) Page(id string) (notion.Page, bool) {
+	s.mu.Lock()
+	p, ok := s.pages[id]
+	var raw map[string]interface{}
+	if ok {
+		raw = s.pageJSON(p)
+	}
+	s.mu.Unlock()
+
+	var result notion.Page
+	if ok {
+		roundTrip(raw, &result)
+	}
+	return result, ok
+}
+
+// Archived 判断页面或块是否已归档
+func (s *Server) Archived(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pages[id]; ok {
+		return p.archived
+	}
+	if b, ok := s.blocks[id]; ok {
+		return b.archived
+	}
+	return false
+}
+
+// Children 返回页面或块下未归档的子块（API 响应格式）
+func (s *Server) Children(id string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []map[string]interface{}
+	for _, childID := range s.children[id] {
+		if b := s.blocks[childID]; !b.archived {
+			result = append(result, s.blockJSON(b))
+		}
+	}
+	return result
+}
+
+// Requests 返回收到的请求，格式为 "POST /v1/pages"（不含被故障规则拦截的请求）
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// apiError Notion 格式的错误响应
+type apiError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) *apiError {
+	return &apiError{http.StatusBadRequest, "validation_error", fmt.Sprintf(format, args...)}
+}
+
+func notFound(id string) *apiError {
+	return &apiError{http.StatusNotFound, "object_not_found", fmt.Sprintf("Could not find object with ID: %s.", id)}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		writeError(w, &apiError{http.StatusUnauthorized, "unauthorized", "API token is invalid."})
+		return
+	}
+	if r.Header.Get("Notion-Version") == "" {
+		writeError(w, badRequest("Notion-Version header failed validation"))
+		return
+	}
+
+	var body map[string]interface{}
+	if r.Method == "POST" || r.Method == "PATCH" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "invalid_json", "Error parsing JSON body."})
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/")
+	s.mu.Lock()
+	result, err := s.route(r.Method, parts, r, body)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) route(method string, parts []string, r *http.Request, body map[string]interface{}) (interface{}, *apiError) {
+	switch {
+	case method == "POST" && len(parts) == 3 && parts[0] == "databases" && parts[2] == "query":
+		return s.queryDatabase(parts[1], body)
+	case method == "POST" && len(parts) == 1 && parts[0] == "pages":
+		return s.handleCreatePage(body)
+	case method == "GET" && len(parts) == 2 && parts[0] == "pages":
+		p, ok := s.pages[parts[1]]
+		if !ok {
+			return nil, notFound(parts[1])
+		}
+		return s.pageJSON(p), nil
+	case method == "PATCH" && len(parts) == 2 && parts[0] == "pages":
+		return s.updatePage(parts[1], body)
+	case method == "GET" && len(parts) == 3 && parts[0] == "blocks" && parts[2] == "children":
+		return s.listChildren(parts[1], r)
+	case method == "PATCH" && len(parts) == 3 && parts[0] == "blocks" && parts[2] == "children":
+		return s.appendChildren(parts[1], body)
+	case method == "GET" && len(parts) == 2 && parts[0] == "blocks":
+		b, ok := s.blocks[parts[1]]
+		if !ok {
+			return nil, notFound(parts[1])
+		}
+		return s.blockJSON(b), nil
+	case method == "PATCH" && len(parts) == 2 && parts[0] == "blocks":
+		return s.updateBlock(parts[1], body)
+	case method == "DELETE" && len(parts) == 2 && parts[0] == "blocks":
+		b, ok := s.blocks[parts[1]]
+		if !ok || b.archived {
+			return nil, notFound(parts[1])
+		}
+		b.archived = true
+		b.edited = s.now()
+		return s.blockJSON(b), nil
+	}
+	return nil, &apiError{http.StatusBadRequest, "invalid_request_url", "Invalid request URL."}
+}
+
+// now 当前时间，与真实 API 一样只精确到分钟
+func (s *Server) now() time.Time {
+	return s.clock.Now().UTC().Truncate(time.Minute)
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.nextID)
+}
+
+func (s *Server) handleCreatePage(body map[string]interface{}) (interface{}, *apiError) {
+	parent, _ := body["parent"].(map[string]interface{})
+	databaseID, _ := parent["database_id"].(string)
+	if databaseID == "" {
+		return nil, badRequest("body.parent.database_id should be defined")
+	}
+	props, _ := body["properties"].(map[string]interface{})
+	p, err := s.createPage(databaseID, props)
+	if err != nil {
+		return nil, err
+	}
+	if children, ok := body["children"].([]interface{}); ok {
+		if _, err := s.addBlocks(p.id, "page_id", children); err != nil {
+			return nil, err
+		}
+	}
+	return s.pageJSON(p), nil
+}
+
+func (s *Server) createPage(databaseID string, props map[string]interface{}) (*page, *apiError) {
+	normalized, err := normalizeProperties(props)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSchema(databaseID, normalized); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	p := &page{
+		id:         s.newID(),
+		databaseID: databaseID,
+		created:    now,
+		edited:     now,
+		indexed:    s.clock.Now().Add(s.queryLag),
+		properties: normalized,
+	}
+	s.pages[p.id] = p
+	s.order = append(s.order, p.id)
+	for name := range normalized {
+		s.syncDual(p, name, nil)
+	}
+	return p, nil
+}
+
+func (s *Server) updatePage(id string, body map[string]interface{}) (interface{}, *apiError) {
+	p, ok := s.pages[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	if p.archived && body["archived"] != false && body["in_trash"] != false {
+		return nil, badRequest("Can't edit block that is archived. You must unarchive the block before editing.")
+	}
+
+	if props, ok := body["properties"].(map[string]interface{}); ok {
+		normalized, err := normalizeProperties(props)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkSchema(p.databaseID, normalized); err != nil {
+			return nil, err
+		}
+		for name, v := range normalized {
+			before := relationIDs(propertyMap(p, name))
+			p.properties[name] = v
+			s.syncDual(p, name, before)
+		}
+	}
+	for _, key := range []string{"archived", "in_trash"} {
+		if v, ok := body[key].(bool); ok {
+			p.archived = v
+		}
+	}
+	p.edited = s.now()
+	return s.pageJSON(p), nil
+}
+
+// checkSchema 检查属性是否存在于数据库中；数据库的属性未固定时记录新属性
+func (s *Server) checkSchema(databaseID string, props map[string]interface{}) *apiError {
+	schema := s.schemas[databaseID]
+	if schema == nil {
+		schema = make(map[string]string)
+		s.schemas[databaseID] = schema
+	}
+	for name, v := range props {
+		typ, _ := v.(map[string]interface{})["type"].(string)
+		if _, ok := schema[name]; !ok {
+			if s.fixed[databaseID] {
+				return &apiError{http.StatusBadRequest, "validation_error", fmt.Sprintf("%s is not a property that exists.", name)}
+			}
+			schema[name] = typ
+		}
+	}
+	return nil
+}
+
+func (s *Server) pageJSON(p *page) map[string]interface{} {
+	properties := make(map[string]interface{}, len(p.properties))
+	for name, v := range p.properties {
+		properties[name] = v
+	}
+	for name, typ := range s.schemas[p.databaseID] {
+		if _, ok := properties[name]; !ok {
+			properties[name] = emptyProperty(name, typ)
+		}
+	}
+	return map[string]interface{}{
+		"object":           "page",
+		"id":               p.id,
+		"created_time":     formatTime(p.created),
+		"last_edited_time": formatTime(p.edited),
+		"archived":         p.archived,
+		"in_trash":         p.archived,
+		"parent":           map[string]interface{}{"type": "database_id", "database_id": p.databaseID},
+		"properties":       properties,
+		"url":              "https://www.notion.so/" + strings.Replace(p.id, "-", "", -1),
+	}
+}
+
+// queryDatabase 按过滤条件、排序和分页参数查询数据库中未归档的页面
+func (s *Server) queryDatabase(databaseID string, body map[string]interface{}) (interface{}, *apiError) {
+	var matched []*page
+	for _, id := range s.order {
+		p := s.pages[id]
+		if p.databaseID != databaseID || p.archived || s.clock.Now().Before(p.indexed) {
+			continue
+		}
+		if filter, ok := body["filter"].(map[string]interface{}); ok {
+			match, err := matchFilter(p, filter)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+		matched = append(matched, p)
+	}
+
+	if sorts, ok := body["sorts"].([]interface{}); ok {
+		if err := sortPages(matched, sorts); err != nil {
+			return nil, err
+		}
+	}
+
+	results, next, err := paginate(len(matched), body["start_cursor"], body["page_size"], func(i int) string { return matched[i].id })
+	if err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, 0, len(results))
+	for _, i := range results {
+		list = append(list, s.pageJSON(matched[i]))
+	}
+	return listJSON(list, next), nil
+}
+
+// matchFilter 判断页面是否满足过滤条件，支持 and/or、时间戳和常用属性类型
+func matchFilter(p *page, filter map[string]interface{}) (bool, *apiError) {
+	if and, ok := filter["and"].([]interface{}); ok {
+		for _, f := range and {
+			sub, _ := f.(map[string]interface{})
+			match, err := matchFilter(p, sub)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	if or, ok := filter["or"].([]interface{}); ok {
+		for _, f := range or {
+			sub, _ := f.(map[string]interface{})
+			match, err := matchFilter(p, sub)
+			if err != nil || match {
+				return match, err
+			}
+		}
+		return false, nil
+	}
+
+	if ts, ok := filter["timestamp"].(string); ok {
+		var value time.Time
+		switch ts {
+		case "last_edited_time":
+			value = p.edited
+		case "created_time":
+			value = p.created
+		default:
+			return false, badRequest("body.filter.timestamp should be created_time or last_edited_time")
+		}
+		cond, _ := filter[ts].(map[string]interface{})
+		return matchTime(value, cond)
+	}
+
+	name, ok := filter["property"].(string)
+	if !ok {
+		return false, badRequest("body.filter should define property, timestamp, and or or")
+	}
+	prop, _ := p.properties[name].(map[string]interface{})
+	for _, typ := range []string{"rich_text", "title", "select", "status"} {
+		cond, ok := filter[typ].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if prop != nil && prop["type"] != typ && !(typ == "rich_text" && prop["type"] == "title") {
+			return false, badRequest("database property %s does not match filter %s", prop["type"], typ)
+		}
+		return matchText(propertyText(prop), cond)
+	}
+	return false, badRequest("unsupported filter on property %q", name)
+}
+
+func matchTime(value time.Time, cond map[string]interface{}) (bool, *apiError) {
+	for op, raw := range cond {
+		s, _ := raw.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return false, badRequest("invalid date %q", s)
+		}
+		switch op {
+		case "on_or_after":
+			return !value.Before(t), nil
+		case "after":
+			return value.After(t), nil
+		case "on_or_before":
+			return !value.After(t), nil
+		case "before":
+			return value.Before(t), nil
+		case "equals":
+			return value.Equal(t), nil
+		default:
+			return false, badRequest("unsupported date filter %q", op)
+		}
+	}
+	return false, badRequest("empty date filter")
+}
+
+func matchText(value string, cond map[string]interface{}) (bool, *apiError) {
+	for op, raw := range cond {
+		s, _ := raw.(string)
+		switch op {
+		case "equals":
+			return value == s, nil
+		case "does_not_equal":
+			return value != s, nil
+		case "contains":
+			return strings.Contains(value, s), nil
+		case "starts_with":
+			return strings.HasPrefix(value, s), nil
+		case "is_empty":
+			return value == "", nil
+		case "is_not_empty":
+			return value != "", nil
+		default:
+			return false, badRequest("unsupported text filter %q", op)
+		}
+	}
+	return false, badRequest("empty text filter")
+}
+
+// propertyText 属性的文本值：rich_text/title 为拼接后的 plain_text，select/status 为名称
+func propertyText(prop map[string]interface{}) string {
+	if prop == nil {
+		return ""
+	}
+	typ, _ := prop["type"].(string)
+	switch v := prop[typ].(type) {
+	case []interface{}:
+		var sb strings.Builder
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				text, _ := m["plain_text"].(string)
+				sb.WriteString(text)
+			}
+		}
+		return sb.String()
+	case map[string]interface{}:
+		name, _ := v["name"].(string)
+		return name
+	}
+	return ""
+}
+
+func sortPages(pages []*page, sorts []interface{}) *apiError {
+	type key struct {
+		timestamp string
+		property  string
+		desc      bool
+	}
+	var keys []key
+	for _, raw := range sorts {
+		m, _ := raw.(map[string]interface{})
+		var k key
+		k.timestamp, _ = m["timestamp"].(string)
+		k.property, _ = m["property"].(string)
+		if k.timestamp == "" && k.property == "" {
+			return badRequest("body.sorts should define property or timestamp")
+		}
+		k.desc = m["direction"] == "descending"
+		keys = append(keys, k)
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		for _, k := range keys {
+			var cmp int
+			switch k.timestamp {
+			case "last_edited_time":
+				cmp = compareTime(pages[i].edited, pages[j].edited)
+			case "created_time":
+				cmp = compareTime(pages[i].created, pages[j].created)
+			default:
+				a := propertyText(propertyMap(pages[i], k.property))
+				b := propertyText(propertyMap(pages[j], k.property))
+				cmp = strings.Compare(a, b)
+			}
+			if cmp != 0 {
+				return (cmp < 0) != k.desc
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// syncDual 属性 name 为双向关联时，按关联的增减更新被关联页面的另一侧属性；before 为修改前的关联
+func (s *Server) syncDual(p *page, name string, before []string) {
+	other, ok := s.duals[name]
+	if !ok {
+		return
+	}
+	after := relationIDs(propertyMap(p, name))
+	for _, id := range before {
+		if target, ok := s.pages[id]; ok && !containsID(after, id) {
+			s.setRelation(target, other, removeID(relationIDs(propertyMap(target, other)), p.id))
+		}
+	}
+	for _, id := range after {
+		if target, ok := s.pages[id]; ok && !containsID(before, id) {
+			ids := relationIDs(propertyMap(target, other))
+			if !containsID(ids, p.id) {
+				s.setRelation(target, other, append(ids, p.id))
+			}
+		}
+	}
+}
+
+// setRelation 直接设置页面的关联属性，不再触发双向同步
+func (s *Server) setRelation(p *page, name string, ids []string) {
+	if s.schemas[p.databaseID] == nil {
+		s.schemas[p.databaseID] = make(map[string]string)
+	}
+	if _, ok := s.schemas[p.databaseID][name]; !ok && !s.fixed[p.databaseID] {
+		s.schemas[p.databaseID][name] = "relation"
+	}
+	relations := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		relations = append(relations, map[string]interface{}{"id": id})
+	}
+	p.properties[name] = map[string]interface{}{"id": propertyID(name), "type": "relation", "relation": relations, "has_more": false}
+	p.edited = s.now()
+}
+
+// relationIDs 关联属性中的页面 ID
+func relationIDs(prop map[string]interface{}) []string {
+	items, _ := prop["relation"].([]interface{})
+	var ids []string
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		if id, _ := m["id"].(string); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(ids []string, id string) []string {
+	var out []string
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func propertyMap(p *page, name string) map[string]interface{} {
+	prop, _ := p.properties[name].(map[string]interface{})
+	return prop
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// paginate 根据 start_cursor 和 page_size 计算返回的下标；游标为下一个结果的 ID
+func paginate(n int, cursor, size interface{}, idAt func(int) string) ([]int, string, *apiError) {
+	pageSize := maxPageSize
+	if size != nil {
+		f, ok := size.(float64)
+		if !ok || f < 1 || f > maxPageSize || f != float64(int(f)) {
+			return nil, "", badRequest("body.page_size should be a number between 1 and 100")
+		}
+		pageSize = int(f)
+	}
+
+	start := 0
+	if c, ok := cursor.(string); ok && c != "" {
+		start = -1
+		for i := 0; i < n; i++ {
+			if idAt(i) == c {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", badRequest("start_cursor %q is invalid", c)
+		}
+	}
+
+	end := start + pageSize
+	if end > n {
+		end = n
+	}
+	indexes := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		indexes = append(indexes, i)
+	}
+	next := ""
+	if end < n {
+		next = idAt(end)
+	}
+	return indexes, next, nil
+}
+
+func listJSON(results []interface{}, next string) map[string]interface{} {
+	list := map[string]interface{}{
+		"object":      "list",
+		"results":     results,
+		"has_more":    next != "",
+		"next_cursor": nil,
+	}
+	if next != "" {
+		list["next_cursor"] = next
+	}
+	return list
+}
+
+func (s *Server) listChildren(id string, r *http.Request) (interface{}, *apiError) {
+	if _, ok := s.pages[id]; !ok {
+		if _, ok := s.blocks[id]; !ok {
+			return nil, notFound(id)
+		}
+	}
+
+	var ids []string
+	for _, childID := range s.children[id] {
+		if !s.blocks[childID].archived {
+			ids = append(ids, childID)
+		}
+	}
+
+	var size interface{}
+	if v := r.URL.Query().Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badRequest("page_size should be a number")
+		}
+		size = float64(n)
+	}
+	indexes, next, err := paginate(len(ids), r.URL.Query().Get("start_cursor"), size, func(i int) string { return ids[i] })
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		results = append(results, s.blockJSON(s.blocks[ids[i]]))
+	}
+	return listJSON(results, next), nil
+}
+
+func (s *Server) appendChildren(id string, body map[string]interface{}) (interface{}, *apiError) {
+	parentType := "page_id"
+	if _, ok := s.pages[id]; !ok {
+		b, ok := s.blocks[id]
+		if !ok || b.archived {
+			return nil, notFound(id)
+		}
+		parentType = "block_id"
+	}
+
+	children, ok := body["children"].([]interface{})
+	if !ok {
+		return nil, badRequest("body.children should be an array")
+	}
+	created, err := s.addBlocks(id, parentType, children)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, len(created))
+	for i, b := range created {
+		results[i] = s.blockJSON(b)
+	}
+	return listJSON(results, ""), nil
+}
+
+// addBlocks 在 parentID 下追加子块，块内容中的 children 递归创建
+func (s *Server) addBlocks(parentID, parentType string, children []interface{}) ([]*block, *apiError) {
+	if len(children) > maxPageSize {
+		return nil, badRequest("body.children.length should be ≤ `100`, instead was `%d`.", len(children))
+	}
+
+	var created []*block
+	for _, raw := range children {
+		m, _ := raw.(map[string]interface{})
+		typ, _ := m["type"].(string)
+		if typ == "" {
+			for k := range m {
+				if k != "object" {
+					typ = k
+				}
+			}
+		}
+		content, ok := m[typ].(map[string]interface{})
+		if !ok {
+			return nil, badRequest("body.children[%d].%s should be an object", len(created), typ)
+		}
+
+		now := s.now()
+		b := &block{
+			id:         s.newID(),
+			parentID:   parentID,
+			parentType: parentType,
+			typ:        typ,
+			content:    normalizeBlockContent(content),
+			created:    now,
+			edited:     now,
+		}
+		s.blocks[b.id] = b
+		s.children[parentID] = append(s.children[parentID], b.id)
+		created = append(created, b)
+
+		if nested, ok := content["children"].([]interface{}); ok {
+			if _, err := s.addBlocks(b.id, "block_id", nested); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return created, nil
+}
+
+func (s *Server) updateBlock(id string, body map[string]interface{}) (interface{}, *apiError) {
+	b, ok := s.blocks[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	if archived, ok := body["archived"].(bool); ok {
+		b.archived = archived
+	} else if b.archived {
+		return nil, badRequest("Can't edit block that is archived. You must unarchive the block before editing.")
+	}
+	if content, ok := body[b.typ].(map[string]interface{}); ok {
+		for k, v := range normalizeBlockContent(content) {
+			b.content[k] = v
+		}
+	}
+	b.edited = s.now()
+	return s.blockJSON(b), nil
+}
+
+func (s *Server) blockJSON(b *block) map[string]interface{} {
+	hasChildren := false
+	for _, childID := range s.children[b.id] {
+		if !s.blocks[childID].archived {
+			hasChildren = true
+			break
+		}
+	}
+	return map[string]interface{}{
+		"object":           "block",
+		"id":               b.id,
+		"parent":           map[string]interface{}{"type": b.parentType, b.parentType: b.parentID},
+		"created_time":     formatTime(b.created),
+		"last_edited_time": formatTime(b.edited),
+		"has_children":     hasChildren,
+		"archived":         b.archived,
+		"in_trash":         b.archived,
+		"type":             b.typ,
+		b.typ:              b.content,
+	}
+}
+
+// normalizeBlockContent 块内容的响应格式：去掉 children，rich_text 补充 plain_text
+func normalizeBlockContent(content map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(content))
+	for k, v := range content {
+		if k == "children" {
+			continue
+		}
+		if k == "rich_text" {
+			if items, ok := v.([]interface{}); ok {
+				v = normalizeRichText(items)
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// propertyTypes 支持的属性类型
+var propertyTypes = []string{
+	"title", "rich_text", "number", "select", "multi_select", "status", "date",
+	"people", "files", "checkbox", "url", "email", "phone_number", "relation",
+}
+
+// normalizeProperties 把请求中的属性值转换为响应格式
+func normalizeProperties(props map[string]interface{}) (map[string]interface{}, *apiError) {
+	out := make(map[string]interface{}, len(props))
+	for name, raw := range props {
+		value, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, badRequest("body.properties.%s should be an object", name)
+		}
+		typ, _ := value["type"].(string)
+		if typ == "" {
+			for _, t := range propertyTypes {
+				if _, ok := value[t]; ok {
+					typ = t
+					break
+				}
+			}
+		}
+		if typ == "" {
+			return nil, badRequest("body.properties.%s should define a property type", name)
+		}
+
+		v := value[typ]
+		switch typ {
+		case "title", "rich_text":
+			items, _ := v.([]interface{})
+			v = normalizeRichText(items)
+		case "relation":
+			items, _ := v.([]interface{})
+			relations := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				m, _ := item.(map[string]interface{})
+				relations = append(relations, map[string]interface{}{"id": m["id"]})
+			}
+			v = relations
+		}
+		prop := map[string]interface{}{"id": propertyID(name), "type": typ, typ: v}
+		if typ == "relation" {
+			prop["has_more"] = false
+		}
+		out[name] = prop
+	}
+	return out, nil
+}
+
+// normalizeRichText 文本项补充 type、plain_text、annotations 和 href
+func normalizeRichText(items []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		text, _ := m["text"].(map[string]interface{})
+		content, _ := text["content"].(string)
+		out = append(out, map[string]interface{}{
+			"type":        "text",
+			"text":        map[string]interface{}{"content": content, "link": text["link"]},
+			"plain_text":  content,
+			"annotations": defaultAnnotations(),
+			"href":        nil,
+		})
+	}
+	return out
+}
+
+func defaultAnnotations() map[string]interface{} {
+	return map[string]interface{}{
+		"bold": false, "italic": false, "strikethrough": false,
+		"underline": false, "code": false, "color": "default",
+	}
+}
+
+// emptyProperty 页面没有设置的属性在响应中的空值
+func emptyProperty(name, typ string) map[string]interface{} {
+	var v interface{}
+	switch typ {
+	case "title", "rich_text", "multi_select", "people", "files", "relation":
+		v = []interface{}{}
+	case "checkbox":
+		v = false
+	}
+	prop := map[string]interface{}{"id": propertyID(name), "type": typ, typ: v}
+	if typ == "relation" {
+		prop["has_more"] = false
+	}
+	return prop
+}
+
+// propertyID 由属性名生成稳定的短 ID
+func propertyID(name string) string {
+	var h uint32 = 2166136261
+	for i := 0; i < len(name); i++ {
+		h = (h ^ uint32(name[i])) * 16777619
+	}
+	return fmt.Sprintf("%04x", h&0xffff)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func roundTrip(in, out interface{}) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.status, map[string]interface{}{
+		"object":  "error",
+		"status":  err.status,
+		"code":    err.code,
+		"message": err.msg,
+	})
+}
@@ -0,0 +1,82 @@
+package notion
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/logging"
+	"dida-to-notion-sync/metrics"
+)
+
+// Option 客户端配置项
+type Option func(*Client)
+
+// WithLogger 设置客户端使用的日志记录器
+func WithLogger(logger *logging.Logger) Option {
+	return func(c *Client) {
+		c.log = logger
+	}
+}
+
+// WithMetrics 设置客户端上报请求指标的目标
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// WithHTTPClient 设置发送请求使用的 HTTP 客户端（如指向 httptest 服务器或自定义 Transport）
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithBaseURL 设置 API 地址，覆盖默认值
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithUserAgent 设置请求的 User-Agent
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout 设置单个请求的超时时间（不影响传入的 HTTP 客户端本身）
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithClock 设置重试等待和耗时统计使用的时钟
+func WithClock(clk clock.Clock) Option {
+	return func(c *Client) {
+		c.clock = clk
+	}
+}
+
+// WithArchiveDuplicates FindPageByDidaID 找到多个相同滴答ID 的页面时，保留最早创建的页面并归档其余页面
+func WithArchiveDuplicates(archive bool) Option {
+	return func(c *Client) {
+		c.archiveDuplicates = archive
+	}
+}
+
+// applyOptions 应用配置项；超时通过复制 HTTP 客户端设置，避免修改共享的 http.DefaultClient
+func (c *Client) applyOptions(opts []Option) {
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout > 0 {
+		hc := *c.httpClient
+		hc.Timeout = c.timeout
+		c.httpClient = &hc
+	}
+}
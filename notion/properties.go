@@ -0,0 +1,488 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 属性类型
+const (
+	PropertyTitle       = "title"
+	PropertyRichText    = "rich_text"
+	PropertyStatus      = "status"
+	PropertySelect      = "select"
+	PropertyMultiSelect = "multi_select"
+	PropertyDate        = "date"
+	PropertyRelation    = "relation"
+	PropertyNumber      = "number"
+	PropertyCheckbox    = "checkbox"
+	PropertyURL         = "url"
+	PropertyFormula     = "formula"
+	PropertyRollup      = "rollup"
+)
+
+// propertyTypes 支持的属性类型，请求中没有 type 字段时按此顺序识别
+var propertyTypes = []string{
+	PropertyTitle, PropertyRichText, PropertyStatus, PropertySelect, PropertyMultiSelect, PropertyDate,
+	PropertyRelation, PropertyNumber, PropertyCheckbox, PropertyURL, PropertyFormula, PropertyRollup,
+}
+
+// Properties 页面属性，键为属性名
+type Properties map[string]PropertyValue
+
+// PropertyValue 页面属性值，Type 决定哪个字段有效。
+// 序列化时按请求格式只输出 Type 对应的字段，值为空时输出 null（用于清空 select、date 等属性）；
+// 反序列化时兼容响应格式（带 id、type）和请求格式（只有类型对应的字段）
+type PropertyValue struct {
+	ID   string
+	Type string
+
+	Title       []RichText
+	RichText    []RichText
+	Status      *SelectOption
+	Select      *SelectOption
+	MultiSelect []SelectOption
+	Date        *Date
+	Relation    []Relation
+	Number      *float64
+	Checkbox    bool
+	URL         *string
+	Formula     *Formula // 只读
+	Rollup      *Rollup  // 只读
+
+	// HasMore relation 超过 25 项时为 true，此时 Relation 不完整
+	HasMore bool
+}
+
+// RichText 富文本片段
+type RichText struct {
+	Type        string       `json:"type,omitempty"`
+	Text        *Text        `json:"text,omitempty"`
+	Annotations *Annotations `json:"annotations,omitempty"`
+	PlainText   string       `json:"plain_text,omitempty"`
+	Href        *string      `json:"href,omitempty"`
+}
+
+// Text 文本内容
+type Text struct {
+	Content string `json:"content"`
+	Link    *Link  `json:"link,omitempty"`
+}
+
+// Link 文本链接
+type Link struct {
+	URL string `json:"url"`
+}
+
+// Annotations 文本样式
+type Annotations struct {
+	Bold          bool   `json:"bold"`
+	Italic        bool   `json:"italic"`
+	Strikethrough bool   `json:"strikethrough"`
+	Underline     bool   `json:"underline"`
+	Code          bool   `json:"code"`
+	Color         string `json:"color"`
+}
+
+// SelectOption select、multi_select 和 status 的选项，写入时只需要 Name
+type SelectOption struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+// Date 日期或日期范围，Start 为 2006-01-02 或 RFC3339 格式
+type Date struct {
+	Start    string  `json:"start"`
+	End      *string `json:"end,omitempty"`
+	TimeZone *string `json:"time_zone,omitempty"`
+}
+
+// Relation 关联的页面
+type Relation struct {
+	ID string `json:"id"`
+}
+
+// Formula 公式属性的计算结果，Type 为 string、number、boolean 或 date
+type Formula struct {
+	Type    string   `json:"type"`
+	String  *string  `json:"string,omitempty"`
+	Number  *float64 `json:"number,omitempty"`
+	Boolean *bool    `json:"boolean,omitempty"`
+	Date    *Date    `json:"date,omitempty"`
+}
+
+// Rollup 汇总属性的计算结果，Type 为 number、date 或 array
+type Rollup struct {
+	Type     string          `json:"type"`
+	Function string          `json:"function,omitempty"`
+	Number   *float64        `json:"number,omitempty"`
+	Date     *Date           `json:"date,omitempty"`
+	Array    []PropertyValue `json:"array,omitempty"`
+}
+
+// NewTitle 标题属性
+func NewTitle(content string) PropertyValue {
+	return PropertyValue{Type: PropertyTitle, Title: NewRichTextList(content)}
+}
+
+// NewRichText 文本属性
+func NewRichText(content string) PropertyValue {
+	return PropertyValue{Type: PropertyRichText, RichText: NewRichTextList(content)}
+}
+
+// NewRichTextList 只有一段纯文本的富文本，content 为空时返回空列表
+func NewRichTextList(content string) []RichText {
+	if content == "" {
+		return []RichText{}
+	}
+	return []RichText{{Type: "text", Text: &Text{Content: content}}}
+}
+
+// NewStatus 状态属性
+func NewStatus(name string) PropertyValue {
+	return PropertyValue{Type: PropertyStatus, Status: &SelectOption{Name: name}}
+}
+
+// NewSelect 单选属性，name 为空时清空
+func NewSelect(name string) PropertyValue {
+	if name == "" {
+		return PropertyValue{Type: PropertySelect}
+	}
+	return PropertyValue{Type: PropertySelect, Select: &SelectOption{Name: name}}
+}
+
+// NewMultiSelect 多选属性
+func NewMultiSelect(names ...string) PropertyValue {
+	options := make([]SelectOption, len(names))
+	for i, name := range names {
+		options[i] = SelectOption{Name: name}
+	}
+	return PropertyValue{Type: PropertyMultiSelect, MultiSelect: options}
+}
+
+// NewDate 日期属性，start 为空时清空
+func NewDate(start string) PropertyValue {
+	if start == "" {
+		return PropertyValue{Type: PropertyDate}
+	}
+	return PropertyValue{Type: PropertyDate, Date: &Date{Start: start}}
+}
+
+// NewRelation 关联属性，按给定顺序关联页面
+func NewRelation(pageIDs ...string) PropertyValue {
+	relations := make([]Relation, len(pageIDs))
+	for i, id := range pageIDs {
+		relations[i] = Relation{ID: id}
+	}
+	return PropertyValue{Type: PropertyRelation, Relation: relations}
+}
+
+// NewNumber 数字属性
+func NewNumber(n float64) PropertyValue {
+	return PropertyValue{Type: PropertyNumber, Number: &n}
+}
+
+// NewCheckbox 复选框属性
+func NewCheckbox(checked bool) PropertyValue {
+	return PropertyValue{Type: PropertyCheckbox, Checkbox: checked}
+}
+
+// NewURL 链接属性，url 为空时清空
+func NewURL(url string) PropertyValue {
+	if url == "" {
+		return PropertyValue{Type: PropertyURL}
+	}
+	return PropertyValue{Type: PropertyURL, URL: &url}
+}
+
+// value 返回 Type 对应字段的值
+func (p PropertyValue) value() (interface{}, error) {
+	switch p.Type {
+	case PropertyTitle:
+		return nonNilRichText(p.Title), nil
+	case PropertyRichText:
+		return nonNilRichText(p.RichText), nil
+	case PropertyStatus:
+		return p.Status, nil
+	case PropertySelect:
+		return p.Select, nil
+	case PropertyMultiSelect:
+		if p.MultiSelect == nil {
+			return []SelectOption{}, nil
+		}
+		return p.MultiSelect, nil
+	case PropertyDate:
+		return p.Date, nil
+	case PropertyRelation:
+		if p.Relation == nil {
+			return []Relation{}, nil
+		}
+		return p.Relation, nil
+	case PropertyNumber:
+		return p.Number, nil
+	case PropertyCheckbox:
+		return p.Checkbox, nil
+	case PropertyURL:
+		return p.URL, nil
+	case PropertyFormula:
+		return p.Formula, nil
+	case PropertyRollup:
+		return p.Rollup, nil
+	}
+	return nil, fmt.Errorf("unsupported property type %q", p.Type)
+}
+
+func nonNilRichText(texts []RichText) []RichText {
+	if texts == nil {
+		return []RichText{}
+	}
+	return texts
+}
+
+// MarshalJSON 按请求格式输出：{"<type>": 值}
+func (p PropertyValue) MarshalJSON() ([]byte, error) {
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{p.Type: v})
+}
+
+// UnmarshalJSON 解析响应或请求格式的属性值；不支持的类型只保留 ID 和 Type
+func (p *PropertyValue) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*p = PropertyValue{}
+	if id, ok := raw["id"]; ok {
+		json.Unmarshal(id, &p.ID)
+	}
+	if t, ok := raw["type"]; ok {
+		if err := json.Unmarshal(t, &p.Type); err != nil {
+			return err
+		}
+	} else {
+		for _, t := range propertyTypes {
+			if _, ok := raw[t]; ok {
+				p.Type = t
+				break
+			}
+		}
+	}
+	if hasMore, ok := raw["has_more"]; ok {
+		json.Unmarshal(hasMore, &p.HasMore)
+	}
+
+	value, ok := raw[p.Type]
+	if !ok {
+		return nil
+	}
+	var target interface{}
+	switch p.Type {
+	case PropertyTitle:
+		target = &p.Title
+	case PropertyRichText:
+		target = &p.RichText
+	case PropertyStatus:
+		target = &p.Status
+	case PropertySelect:
+		target = &p.Select
+	case PropertyMultiSelect:
+		target = &p.MultiSelect
+	case PropertyDate:
+		target = &p.Date
+	case PropertyRelation:
+		target = &p.Relation
+	case PropertyNumber:
+		target = &p.Number
+	case PropertyCheckbox:
+		target = &p.Checkbox
+	case PropertyURL:
+		target = &p.URL
+	case PropertyFormula:
+		target = &p.Formula
+	case PropertyRollup:
+		target = &p.Rollup
+	default:
+		return nil
+	}
+	if err := json.Unmarshal(value, target); err != nil {
+		return fmt.Errorf("property type %s: %w", p.Type, err)
+	}
+	return nil
+}
+
+// PlainText 属性的文本形式：标题和文本为拼接后的纯文本，选项为名称，
+// 数字、复选框、日期和公式结果转换为字符串
+func (p PropertyValue) PlainText() string {
+	switch p.Type {
+	case PropertyTitle:
+		return richTextPlain(p.Title)
+	case PropertyRichText:
+		return richTextPlain(p.RichText)
+	case PropertyStatus:
+		return optionName(p.Status)
+	case PropertySelect:
+		return optionName(p.Select)
+	case PropertyMultiSelect:
+		names := make([]string, len(p.MultiSelect))
+		for i, o := range p.MultiSelect {
+			names[i] = o.Name
+		}
+		return strings.Join(names, ", ")
+	case PropertyDate:
+		if p.Date != nil {
+			return p.Date.Start
+		}
+	case PropertyNumber:
+		if p.Number != nil {
+			return strconv.FormatFloat(*p.Number, 'f', -1, 64)
+		}
+	case PropertyCheckbox:
+		return strconv.FormatBool(p.Checkbox)
+	case PropertyURL:
+		if p.URL != nil {
+			return *p.URL
+		}
+	case PropertyFormula:
+		if f := p.Formula; f != nil {
+			switch {
+			case f.String != nil:
+				return *f.String
+			case f.Number != nil:
+				return strconv.FormatFloat(*f.Number, 'f', -1, 64)
+			case f.Boolean != nil:
+				return strconv.FormatBool(*f.Boolean)
+			case f.Date != nil:
+				return f.Date.Start
+			}
+		}
+	case PropertyRollup:
+		if r := p.Rollup; r != nil {
+			switch {
+			case r.Number != nil:
+				return strconv.FormatFloat(*r.Number, 'f', -1, 64)
+			case r.Date != nil:
+				return r.Date.Start
+			}
+		}
+	}
+	return ""
+}
+
+// richTextPlain 拼接富文本的纯文本；请求格式的片段没有 plain_text 时使用 text.content
+func richTextPlain(texts []RichText) string {
+	var sb strings.Builder
+	for _, t := range texts {
+		if t.PlainText != "" {
+			sb.WriteString(t.PlainText)
+		} else if t.Text != nil {
+			sb.WriteString(t.Text.Content)
+		}
+	}
+	return sb.String()
+}
+
+func optionName(o *SelectOption) string {
+	if o == nil {
+		return ""
+	}
+	return o.Name
+}
+
+// Property 按名称获取属性
+func (p Page) Property(name string) (PropertyValue, bool) {
+	v, ok := p.Properties[name]
+	return v, ok
+}
+
+// Text 标题或文本属性的纯文本，属性不存在或类型不符时返回 false
+func (p Page) Text(name string) (string, bool) {
+	v, ok := p.Properties[name]
+	if !ok || (v.Type != PropertyTitle && v.Type != PropertyRichText) {
+		return "", false
+	}
+	return v.PlainText(), true
+}
+
+// Status 状态属性的名称，属性不存在、类型不符或未设置时返回 false
+func (p Page) Status(name string) (string, bool) {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyStatus || v.Status == nil {
+		return "", false
+	}
+	return v.Status.Name, true
+}
+
+// Select 单选属性的名称，属性不存在、类型不符或未设置时返回 false
+func (p Page) Select(name string) (string, bool) {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertySelect || v.Select == nil {
+		return "", false
+	}
+	return v.Select.Name, true
+}
+
+// MultiSelect 多选属性的名称列表
+func (p Page) MultiSelect(name string) []string {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyMultiSelect {
+		return nil
+	}
+	names := make([]string, len(v.MultiSelect))
+	for i, o := range v.MultiSelect {
+		names[i] = o.Name
+	}
+	return names
+}
+
+// Date 日期属性，未设置时返回 nil
+func (p Page) Date(name string) *Date {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyDate {
+		return nil
+	}
+	return v.Date
+}
+
+// Relation 关联属性中的页面 ID，按 Notion 返回的顺序排列
+func (p Page) Relation(name string) []string {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyRelation {
+		return nil
+	}
+	ids := make([]string, len(v.Relation))
+	for i, r := range v.Relation {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// Number 数字属性，未设置时返回 false
+func (p Page) Number(name string) (float64, bool) {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyNumber || v.Number == nil {
+		return 0, false
+	}
+	return *v.Number, true
+}
+
+// Checkbox 复选框属性
+func (p Page) Checkbox(name string) bool {
+	v, ok := p.Properties[name]
+	return ok && v.Type == PropertyCheckbox && v.Checkbox
+}
+
+// URL 链接属性，未设置时返回空字符串
+func (p Page) URL(name string) string {
+	v, ok := p.Properties[name]
+	if !ok || v.Type != PropertyURL || v.URL == nil {
+		return ""
+	}
+	return *v.URL
+}
@@ -0,0 +1,92 @@
+package notion
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPropertiesUnmarshalResponse(t *testing.T) {
+	data := []byte(`{
+		"id": "page-1",
+		"created_time": "2026-10-01T02:00:00.000Z",
+		"last_edited_time": "2026-10-12T08:30:00.000Z",
+		"archived": false,
+		"properties": {
+			"名称": {"id": "title", "type": "title", "title": [{"type": "text", "text": {"content": "写周报", "link": null}, "plain_text": "写周报", "href": null}]},
+			"滴答ID": {"id": "a%3Db", "type": "rich_text", "rich_text": [{"type": "text", "text": {"content": "6707a8e1b8f0d14a2c9e0001"}, "plain_text": "6707a8e1b8f0d14a2c9e0001"}]},
+			"状态": {"id": "s", "type": "status", "status": {"id": "done", "name": "完成", "color": "green"}},
+			"项目": {"id": "p", "type": "select", "select": null},
+			"日期": {"id": "d", "type": "date", "date": {"start": "2026-10-20", "end": null, "time_zone": null}},
+			"子任务": {"id": "c", "type": "relation", "relation": [{"id": "page-2"}, {"id": "page-3"}], "has_more": true},
+			"工时": {"id": "n", "type": "number", "number": 1.5},
+			"重要": {"id": "k", "type": "checkbox", "checkbox": true},
+			"进度": {"id": "f", "type": "formula", "formula": {"type": "number", "number": 50}},
+			"参与人": {"id": "x", "type": "people", "people": []}
+		}
+	}`)
+
+	var page Page
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	if title, ok := page.Text("名称"); !ok || title != "写周报" {
+		t.Errorf("名称 = %q, %v", title, ok)
+	}
+	if status, ok := page.Status("状态"); !ok || status != "完成" {
+		t.Errorf("状态 = %q, %v", status, ok)
+	}
+	if _, ok := page.Select("项目"); ok {
+		t.Error("empty select reported as set")
+	}
+	if d := page.Date("日期"); d == nil || d.Start != "2026-10-20" {
+		t.Errorf("日期 = %+v", d)
+	}
+	if ids := page.Relation("子任务"); len(ids) != 2 || ids[0] != "page-2" || !page.Properties["子任务"].HasMore {
+		t.Errorf("子任务 = %v", ids)
+	}
+	if n, ok := page.Number("工时"); !ok || n != 1.5 {
+		t.Errorf("工时 = %v, %v", n, ok)
+	}
+	if !page.Checkbox("重要") {
+		t.Error("重要 = false")
+	}
+	if got := page.Properties["进度"].PlainText(); got != "50" {
+		t.Errorf("进度 = %q", got)
+	}
+	if p := page.Properties["参与人"]; p.Type != "people" {
+		t.Errorf("unsupported type = %+v", p)
+	}
+	// 类型不符时访问器返回 false
+	if _, ok := page.Status("名称"); ok {
+		t.Error("Status on a title property")
+	}
+}
+
+func TestPropertiesMarshalRequest(t *testing.T) {
+	props := Properties{
+		"名称":  NewTitle("写周报"),
+		"项目":  NewSelect(""),
+		"父任务": NewRelation("page-1"),
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"名称":{"title":[{"type":"text","text":{"content":"写周报"}}]},"父任务":{"relation":[{"id":"page-1"}]},"项目":{"select":null}}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+
+	// 请求格式也能解析回来
+	var back Properties
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back["名称"].PlainText() != "写周报" || back["项目"].Type != PropertySelect || back["项目"].Select != nil {
+		t.Errorf("round trip = %+v", back)
+	}
+
+	if _, err := json.Marshal(PropertyValue{Type: "people"}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
@@ -0,0 +1,221 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPageSize 查询每页数量的上限
+const maxPageSize = 100
+
+// 排序方向
+const (
+	Ascending  = "ascending"
+	Descending = "descending"
+)
+
+// Sort 查询排序条件，Property 和 Timestamp（created_time、last_edited_time）二选一
+type Sort struct {
+	Property  string `json:"property,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Direction string `json:"direction"`
+}
+
+// Query 数据库查询条件
+type Query struct {
+	Filter      map[string]interface{}
+	Sorts       []Sort
+	PageSize    int    // 每页数量，0 使用 API 默认值（100），最大 100
+	StartCursor string // 从上一页响应的 NextCursor 继续
+}
+
+// body 查询的请求体
+func (q Query) body() map[string]interface{} {
+	body := map[string]interface{}{}
+	if q.Filter != nil {
+		body["filter"] = q.Filter
+	}
+	if len(q.Sorts) > 0 {
+		body["sorts"] = q.Sorts
+	}
+	if q.PageSize > 0 {
+		body["page_size"] = q.PageSize
+	}
+	if q.StartCursor != "" {
+		body["start_cursor"] = q.StartCursor
+	}
+	return body
+}
+
+// QueryResponse 查询响应
+type QueryResponse struct {
+	Results    []Page `json:"results"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// QueryDatabase 查询数据库的一页结果；HasMore 为 true 时用 NextCursor 作为 StartCursor 获取下一页
+func (c *Client) QueryDatabase(ctx context.Context, q Query) (*QueryResponse, error) {
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	var result QueryResponse
+	path := fmt.Sprintf("/databases/%s/query", c.databaseID)
+	if err := c.doRequest(ctx, "POST", path, q.body(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PageIterator 逐页获取查询结果，用法：
+//
+//	it := client.QueryPages(ctx, q)
+//	for it.Next() {
+//		page := it.Page()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type PageIterator struct {
+	ctx    context.Context
+	client *Client
+	query  Query
+	buf    []Page
+	pos    int
+	done   bool
+	err    error
+}
+
+// QueryPages 返回遍历所有查询结果的迭代器，需要时才请求下一页
+func (c *Client) QueryPages(ctx context.Context, q Query) *PageIterator {
+	return &PageIterator{ctx: ctx, client: c, query: q, pos: -1}
+}
+
+// Next 移动到下一个页面，没有更多结果或出错时返回 false
+func (it *PageIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.pos++
+	for it.pos >= len(it.buf) {
+		if it.done {
+			return false
+		}
+		result, err := it.client.QueryDatabase(it.ctx, it.query)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.buf, it.pos = result.Results, 0
+		it.query.StartCursor = result.NextCursor
+		it.done = !result.HasMore || result.NextCursor == ""
+	}
+	return true
+}
+
+// Page 当前页面，只能在 Next 返回 true 后调用
+func (it *PageIterator) Page() Page {
+	return it.buf[it.pos]
+}
+
+// Err 遍历中遇到的错误
+func (it *PageIterator) Err() error {
+	return it.err
+}
+
+// queryAllPages 按给定的查询条件分页获取所有结果
+func (c *Client) queryAllPages(ctx context.Context, q Query) ([]Page, error) {
+	var allPages []Page
+	it := c.QueryPages(ctx, q)
+	for it.Next() {
+		allPages = append(allPages, it.Page())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return allPages, nil
+}
+
+// GetAllPages 获取数据库中所有页面
+func (c *Client) GetAllPages(ctx context.Context) ([]Page, error) {
+	return c.queryAllPages(ctx, Query{})
+}
+
+// GetPagesEditedSince 获取在 since 之后（含）编辑过的页面，按编辑时间升序排列。
+// Notion 的 last_edited_time 精确到分钟，调用方应能处理重复返回的页面
+func (c *Client) GetPagesEditedSince(ctx context.Context, since time.Time) ([]Page, error) {
+	return c.queryAllPages(ctx, Query{
+		Filter: map[string]interface{}{
+			"timestamp": "last_edited_time",
+			"last_edited_time": map[string]interface{}{
+				"on_or_after": since.UTC().Format(time.RFC3339),
+			},
+		},
+		Sorts: []Sort{{Timestamp: "last_edited_time", Direction: Ascending}},
+	})
+}
+
+// FindPagesByDidaID 获取 滴答ID 等于 didaID 的所有页面，最早创建的在前
+func (c *Client) FindPagesByDidaID(ctx context.Context, didaID string) ([]Page, error) {
+	pages, err := c.queryAllPages(ctx, Query{
+		Filter: map[string]interface{}{
+			"property": "滴答ID",
+			"rich_text": map[string]interface{}{
+				"equals": didaID,
+			},
+		},
+		Sorts: []Sort{{Timestamp: "created_time", Direction: Ascending}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	SortOldestFirst(pages)
+	return pages, nil
+}
+
+// SortOldestFirst 按创建时间升序排列页面；created_time 只精确到分钟，时间相同时按 ID 排列
+func SortOldestFirst(pages []Page) {
+	sort.SliceStable(pages, func(i, j int) bool {
+		if !pages[i].CreatedTime.Equal(pages[j].CreatedTime) {
+			return pages[i].CreatedTime.Before(pages[j].CreatedTime)
+		}
+		return pages[i].ID < pages[j].ID
+	})
+}
+
+// FindPageByDidaID 通过滴答ID查找页面，不存在时返回 nil。
+// 多个页面有相同的滴答ID 时返回最早创建的页面并记录警告；
+// 设置了 WithArchiveDuplicates 时归档其余页面（不迁移它们的关联）
+func (c *Client) FindPageByDidaID(ctx context.Context, didaID string) (*Page, error) {
+	pages, err := c.FindPagesByDidaID(ctx, didaID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, nil
+	}
+
+	keep, duplicates := pages[0], pages[1:]
+	if len(duplicates) == 0 {
+		return &keep, nil
+	}
+	ids := make([]string, len(duplicates))
+	for i, p := range duplicates {
+		ids[i] = p.ID
+	}
+	if !c.archiveDuplicates {
+		c.log.Warn(fmt.Sprintf("滴答ID %s 对应 %d 个页面，使用最早创建的页面", didaID, len(pages)),
+			"task_id", didaID, "page_id", keep.ID, "duplicates", strings.Join(ids, ","))
+		return &keep, nil
+	}
+	for _, id := range ids {
+		if err := c.ArchivePage(ctx, id); err != nil {
+			c.log.Warn("归档重复页面失败", "task_id", didaID, "page_id", id, "error", err)
+			continue
+		}
+		c.log.Info("已归档重复页面", "task_id", didaID, "page_id", id, "kept", keep.ID)
+	}
+	return &keep, nil
+}
@@ -0,0 +1,106 @@
+package notion_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"dida-to-notion-sync/clock"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/notion/notiontest"
+)
+
+func TestQueryPagesIteratesAllResultsInOrder(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	client := srv.NewClient("database-id")
+	for i := 0; i < 250; i++ {
+		srv.AddPage("database-id", notion.Properties{"名称": notion.NewTitle(fmt.Sprintf("任务 %03d", i))})
+	}
+
+	it := client.QueryPages(context.Background(), notion.Query{
+		Sorts:    []notion.Sort{{Property: "名称", Direction: notion.Descending}},
+		PageSize: 100,
+	})
+	var titles []string
+	for it.Next() {
+		title, _ := it.Page().Text("名称")
+		titles = append(titles, title)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 250 || titles[0] != "任务 249" || titles[249] != "任务 000" {
+		t.Fatalf("got %d titles, first %q", len(titles), titles[0])
+	}
+	if n := countRequests(srv, "POST /v1/databases/"); n != 3 {
+		t.Errorf("query requests = %d, want 3", n)
+	}
+
+	// 单页查询返回游标，从游标继续
+	first, err := client.QueryDatabase(context.Background(), notion.Query{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.QueryDatabase(context.Background(), notion.Query{PageSize: 2, StartCursor: first.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.HasMore || len(second.Results) != 2 || second.Results[0].ID == first.Results[0].ID {
+		t.Errorf("first = %+v, second = %+v", first, second)
+	}
+}
+
+func TestFindPageByDidaIDWithDuplicates(t *testing.T) {
+	srv := notiontest.NewServer()
+	defer srv.Close()
+	clk := clock.NewFake(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+	srv.SetClock(clk)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, srv.AddPage("database-id", notion.Properties{
+			"名称":   notion.NewTitle("重复的任务"),
+			"滴答ID": notion.DidaIDProperty("6707a8e1b8f0d14a2c9e0001"),
+		}))
+		clk.Advance(time.Minute)
+	}
+	srv.AddPage("database-id", notion.Properties{"滴答ID": notion.DidaIDProperty("6707a8e1b8f0d14a2c9e0002")})
+
+	pages, err := srv.NewClient("database-id").FindPagesByDidaID(context.Background(), "6707a8e1b8f0d14a2c9e0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 || pages[0].ID != ids[0] || pages[2].ID != ids[2] {
+		t.Fatalf("pages = %+v", pages)
+	}
+
+	// 默认只报告，不归档
+	page, err := srv.NewClient("database-id").FindPageByDidaID(context.Background(), "6707a8e1b8f0d14a2c9e0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page == nil || page.ID != ids[0] || srv.Archived(ids[1]) {
+		t.Fatalf("page = %+v", page)
+	}
+
+	client := srv.NewClient("database-id", notion.WithArchiveDuplicates(true))
+	page, err = client.FindPageByDidaID(context.Background(), "6707a8e1b8f0d14a2c9e0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page == nil || page.ID != ids[0] {
+		t.Fatalf("page = %+v", page)
+	}
+	if srv.Archived(ids[0]) || !srv.Archived(ids[1]) || !srv.Archived(ids[2]) {
+		t.Errorf("archived = %v %v %v", srv.Archived(ids[0]), srv.Archived(ids[1]), srv.Archived(ids[2]))
+	}
+	if pages, _ := client.FindPagesByDidaID(context.Background(), "6707a8e1b8f0d14a2c9e0001"); len(pages) != 1 {
+		t.Errorf("%d pages left", len(pages))
+	}
+
+	if page, err := client.FindPageByDidaID(context.Background(), "missing"); err != nil || page != nil {
+		t.Errorf("missing = %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/state"
+)
+
+// pendingCreates 未确认结果的页面创建。创建页面前先记录到状态文件，结果确认后删除；
+// 创建请求超时等情况下页面可能已经存在，下次创建前要先等待并查找，避免重复创建。
+// 记录保存在内存中，每个阶段开始时一次性写入即将创建的页面，结束时一次性写入确认结果
+type pendingCreates struct {
+	file       string // 状态文件，为空时只保存在内存中
+	databaseID string
+
+	mu      sync.Mutex
+	records map[string]time.Time // 滴答ID -> 开始时间
+	unsent  map[string]bool      // 已记录但还没有发出创建请求
+	added   map[string]time.Time // 上次写入后新增的记录
+	removed map[string]bool      // 上次写入后删除的记录
+}
+
+// loadPendingCreates 从状态文件加载数据库 databaseID 的未确认创建
+func loadPendingCreates(file, databaseID string) *pendingCreates {
+	p := &pendingCreates{
+		file:       file,
+		databaseID: databaseID,
+		records:    make(map[string]time.Time),
+		unsent:     make(map[string]bool),
+		added:      make(map[string]time.Time),
+		removed:    make(map[string]bool),
+	}
+	if file == "" {
+		return p
+	}
+	st, err := state.Load(file)
+	if err != nil {
+		logger.Warn("警告: 加载状态文件失败，无法检查未确认的页面创建", "file", file, "error", err)
+		return p
+	}
+	for key, at := range st.PendingCreates[databaseID] {
+		p.records[key] = at
+	}
+	return p
+}
+
+// has 判断 key 是否有上次运行遗留的未确认创建
+func (p *pendingCreates) has(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.records[key]
+	return ok && !p.unsent[key]
+}
+
+// reserve 在创建阶段开始前记录可能要创建的页面，一次写入状态文件
+func (p *pendingCreates) reserve(keys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := syncClock.Now()
+	for _, key := range keys {
+		if _, ok := p.records[key]; ok {
+			continue
+		}
+		p.records[key] = now
+		p.unsent[key] = true
+		p.added[key] = now
+		delete(p.removed, key)
+	}
+	p.flush()
+}
+
+// sending 在发出 key 的创建请求前调用；没有预先记录的 key 立即写入状态文件
+func (p *pendingCreates) sending(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unsent[key] {
+		delete(p.unsent, key)
+		return
+	}
+	if _, ok := p.records[key]; ok {
+		return
+	}
+	now := syncClock.Now()
+	p.records[key] = now
+	p.added[key] = now
+	delete(p.removed, key)
+	p.flush()
+}
+
+// remove 在 key 的创建结果确认后调用，在 finish 时写入
+func (p *pendingCreates) remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeLocked(key)
+}
+
+func (p *pendingCreates) removeLocked(key string) {
+	if _, ok := p.records[key]; !ok {
+		return
+	}
+	delete(p.records, key)
+	delete(p.unsent, key)
+	delete(p.added, key)
+	p.removed[key] = true
+}
+
+// finish 在创建阶段结束时调用：删除没有发出请求的记录，把确认结果一次写入状态文件
+func (p *pendingCreates) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.unsent {
+		p.removeLocked(key)
+	}
+	p.flush()
+}
+
+// flush 把上次写入后的变化合并到状态文件；只修改本数据库的记录，调用时持有 mu
+func (p *pendingCreates) flush() {
+	if p.file == "" || len(p.added) == 0 && len(p.removed) == 0 {
+		return
+	}
+	err := state.Update(p.file, func(st *state.State) {
+		saved := st.PendingCreatesOf(p.databaseID)
+		for key, at := range p.added {
+			saved[key] = at
+		}
+		for key := range p.removed {
+			delete(saved, key)
+		}
+		if len(saved) == 0 {
+			delete(st.PendingCreates, p.databaseID)
+		}
+	})
+	if err != nil {
+		logger.Warn("警告: 保存状态文件失败", "file", p.file, "error", err)
+		return
+	}
+	p.added = make(map[string]time.Time)
+	p.removed = make(map[string]bool)
+}
@@ -0,0 +1,134 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Run 一次同步运行的结构化报告
+type Run struct {
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	DurationMS int64               `json:"duration_ms"`
+	Phases     []Phase             `json:"phases"`
+	Counts     Counts              `json:"counts"`
+	Failures   []Failure           `json:"failures,omitempty"`
+	API        map[string]APIStats `json:"api,omitempty"`
+	Error      string              `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// Phase 同步阶段耗时
+type Phase struct {
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Counts 各类操作的数量统计
+type Counts struct {
+	Projects        int `json:"projects"`
+	Tasks           int `json:"tasks"`
+	Created         int `json:"created"`
+	Updated         int `json:"updated"`
+	Skipped         int `json:"skipped"`
+	Failed          int `json:"failed"`
+	Relations       int `json:"relations"`
+	RelationsFailed int `json:"relations_failed"`
+	Completed       int `json:"completed"`
+	CompleteFailed  int `json:"complete_failed"`
+}
+
+// Failure 单个任务的失败记录
+type Failure struct {
+	Phase  string `json:"phase"`
+	DidaID string `json:"dida_id,omitempty"`
+	PageID string `json:"page_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Error  string `json:"error"`
+}
+
+// APIStats API 调用统计
+type APIStats struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	Retries  int64 `json:"retries"`
+}
+
+// Sub 返回相对于 before 的增量，用于计算单次运行的调用次数
+func (s APIStats) Sub(before APIStats) APIStats {
+	return APIStats{
+		Requests: s.Requests - before.Requests,
+		Errors:   s.Errors - before.Errors,
+		Retries:  s.Retries - before.Retries,
+	}
+}
+
+// Add 返回两者之和，用于合并多个账号的调用次数
+func (s APIStats) Add(other APIStats) APIStats {
+	return APIStats{
+		Requests: s.Requests + other.Requests,
+		Errors:   s.Errors + other.Errors,
+		Retries:  s.Retries + other.Retries,
+	}
+}
+
+// New 创建新的运行报告
+func New() *Run {
+	return &Run{
+		StartedAt: time.Now(),
+		API:       make(map[string]APIStats),
+	}
+}
+
+// StartPhase 开始一个阶段，返回的函数用于结束该阶段并记录耗时
+func (r *Run) StartPhase(name string) func() {
+	start := time.Now()
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.Phases = append(r.Phases, Phase{
+			Name:       name,
+			StartedAt:  start,
+			DurationMS: time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// AddFailure 记录一个失败的任务
+func (r *Run) AddFailure(phase, didaID, pageID, title string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failures = append(r.Failures, Failure{
+		Phase:  phase,
+		DidaID: didaID,
+		PageID: pageID,
+		Title:  title,
+		Error:  err.Error(),
+	})
+}
+
+// Finish 结束运行并记录总耗时及错误（如有）
+func (r *Run) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FinishedAt = time.Now()
+	r.DurationMS = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// WriteFile 将报告以 JSON 格式写入文件
+func (r *Run) WriteFile(filename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
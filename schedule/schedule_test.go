@@ -0,0 +1,125 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 5, want: []int{0, 1, 2, 3, 4, 5}},
+		{field: "3", min: 0, max: 59, want: []int{3}},
+		{field: "1,4,7", min: 0, max: 59, want: []int{1, 4, 7}},
+		{field: "10-13", min: 0, max: 59, want: []int{10, 11, 12, 13}},
+		{field: "*/15", min: 0, max: 59, want: []int{0, 15, 30, 45}},
+		{field: "10-20/5", min: 0, max: 59, want: []int{10, 15, 20}},
+		{field: "50/5", min: 0, max: 59, want: []int{50, 55}},
+		{field: "1-3,20", min: 1, max: 31, want: []int{1, 2, 3, 20}},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-2", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "a", min: 0, max: 59, wantErr: true},
+		{field: "1-x", min: 0, max: 59, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseField(tt.field, tt.min, tt.max)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseField(%q) = %b, want error", tt.field, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseField(%q): %v", tt.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if got != want {
+			t.Errorf("parseField(%q) = %b, want %b", tt.field, got, want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"61 * * * *",
+		"* 24 * * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		// 永远不会触发的日期
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-18 是星期日
+	from := time.Date(2026, 10, 18, 9, 30, 20, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 18, 9, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 18, 9, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 8-10 * * *", time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		// 7 和 0 都表示星期日
+		{"0 12 * * 7", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)},
+		// 日期和星期都受限时取并集：20 日（星期二）或星期一
+		{"0 0 20 * 1", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 3", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		// 只有日期受限时星期不参与
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 闰日
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextNoMatch(t *testing.T) {
+	// ParseCron 会拒绝该表达式，直接构造以检查 Next 的兜底行为
+	c := &Cron{minute: 1, hour: 1, dom: 1 << 30, month: 1 << 2, dow: 0xff, dowStar: true}
+	if got := c.Next(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %v, want zero time", got)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2026, 10, 18, 9, 30, 20, 0, time.UTC)
+	if got := Every(15 * time.Minute).Next(from); !got.Equal(from.Add(15 * time.Minute)) {
+		t.Errorf("Next = %v", got)
+	}
+}
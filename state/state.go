@@ -0,0 +1,127 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/report"
+)
+
+// State 本地持久化的同步状态
+type State struct {
+	// LastSyncAt 最近一次成功同步的开始时间，增量同步以此为起点
+	LastSyncAt time.Time `json:"last_sync_at,omitempty"`
+
+	// NotionPollCursors 各 Notion 数据库轮询变更时已处理到的 last_edited_time
+	NotionPollCursors map[string]time.Time `json:"notion_poll_cursors,omitempty"`
+
+	// NotionPollCursor 旧版本的单数据库轮询游标，数据库在 NotionPollCursors 中没有记录时作为起点
+	NotionPollCursor time.Time `json:"notion_poll_cursor,omitempty"`
+
+	// PendingCreates 各 Notion 数据库中已发出但未确认结果的页面创建（滴答ID -> 开始时间）；
+	// 下次创建前先查找页面是否已存在
+	PendingCreates map[string]map[string]time.Time `json:"pending_page_creates,omitempty"`
+
+	// TaskProjects 各 Notion 数据库中任务所在的滴答清单项目 ID（滴答ID -> 项目 ID）。
+	// 项目获取失败时据此判断哪些页面属于该项目，不依赖可以手动修改的 项目 属性
+	TaskProjects map[string]map[string]string `json:"task_projects,omitempty"`
+
+	// Runs 最近的同步运行记录（最新的在最后）
+	Runs []*report.Run `json:"runs,omitempty"`
+}
+
+// fileMu 保护同一进程内对状态文件的读-改-写
+var fileMu sync.Mutex
+
+// Update 加载状态文件，调用 fn 修改后保存；同一进程内的并发调用会依次执行
+func Update(filename string, fn func(*State)) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	s, err := Load(filename)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	return s.Save(filename)
+}
+
+// Load 从文件加载状态，文件不存在时返回空状态
+func Load(filename string) (*State, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save 保存状态到文件
+func (s *State) Save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// PollCursor 返回数据库的轮询游标
+func (s *State) PollCursor(databaseID string) time.Time {
+	if cursor, ok := s.NotionPollCursors[databaseID]; ok {
+		return cursor
+	}
+	return s.NotionPollCursor
+}
+
+// SetPollCursor 更新数据库的轮询游标
+func (s *State) SetPollCursor(databaseID string, cursor time.Time) {
+	if s.NotionPollCursors == nil {
+		s.NotionPollCursors = make(map[string]time.Time)
+	}
+	s.NotionPollCursors[databaseID] = cursor
+}
+
+// AddRun 追加一次运行记录，只保留最近 keep 条
+func (s *State) AddRun(run *report.Run, keep int) {
+	s.Runs = append(s.Runs, run)
+	if keep > 0 && len(s.Runs) > keep {
+		s.Runs = s.Runs[len(s.Runs)-keep:]
+	}
+}
+
+// TaskProjectsOf 返回数据库的任务项目记录，修改返回值即修改状态
+func (s *State) TaskProjectsOf(databaseID string) map[string]string {
+	if s.TaskProjects == nil {
+		s.TaskProjects = make(map[string]map[string]string)
+	}
+	if s.TaskProjects[databaseID] == nil {
+		s.TaskProjects[databaseID] = make(map[string]string)
+	}
+	return s.TaskProjects[databaseID]
+}
+
+// PendingCreatesOf 返回数据库的未确认页面创建，修改返回值即修改状态
+func (s *State) PendingCreatesOf(databaseID string) map[string]time.Time {
+	if s.PendingCreates == nil {
+		s.PendingCreates = make(map[string]map[string]time.Time)
+	}
+	if s.PendingCreates[databaseID] == nil {
+		s.PendingCreates[databaseID] = make(map[string]time.Time)
+	}
+	return s.PendingCreates[databaseID]
+}
+
+// HasPendingCreate 判断 key 在该数据库中是否有未确认的页面创建
+func (s *State) HasPendingCreate(key, databaseID string) bool {
+	_, ok := s.PendingCreates[databaseID][key]
+	return ok
+}
@@ -0,0 +1,823 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/notion"
+	"dida-to-notion-sync/report"
+)
+
+// errInterrupted 收到停止信号后，当前任务完成即结束同步
+var errInterrupted = errors.New("收到停止信号，同步已中断")
+
+var (
+	shutdown     = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// requestShutdown 请求在当前任务完成后停止同步
+func requestShutdown() {
+	shutdownOnce.Do(func() { close(shutdown) })
+}
+
+// shuttingDown 判断是否已请求停止
+func shuttingDown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// session 进程内复用的客户端，守护模式下多次同步共享同一个 session
+type session struct {
+	cfg     *config.Config
+	account config.Account
+	ns      namespace
+	oauth   *dida.OAuth
+	store   dida.TokenStore
+	dida    *dida.Client
+	notion  *notion.Client // 未配置 Notion 时为 nil
+
+	// tasks 最近一次获取到的滴答任务，供状态监听查找任务所在项目
+	tasks *taskIndex
+
+	// running 保证同一时间只有一次同步在进行
+	running chan struct{}
+
+	// needsRefresh 上次同步返回 401，下次同步前强制刷新 token
+	needsRefresh bool
+
+	// taskProjects 上次同步时任务所在的项目（任务 ID -> 项目 ID），为 nil 时从状态文件加载
+	taskProjects map[string]string
+}
+
+// newSession 加载（或交互式获取）账号的授权信息并创建客户端
+func newSession(cfg *config.Config, acc config.Account) (*session, error) {
+	if acc.DidaClientID == "" || acc.DidaClientSecret == "" {
+		return nil, withCode(exitConfigError, fmt.Errorf("请在 .env 文件中配置 DIDA_CLIENT_ID 和 DIDA_CLIENT_SECRET"))
+	}
+
+	store, err := newTokenStore(acc)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建 OAuth 客户端
+	oauth := newOAuth(acc)
+	for _, sink := range newTokenSinks(cfg, acc) {
+		oauth.AddSink(sink)
+	}
+
+	// 尝试加载已有的 token
+	if err := oauth.LoadToken(store); err != nil {
+		if err != dida.ErrTokenNotFound {
+			return nil, withCode(exitAuthError, fmt.Errorf("读取授权信息失败: %w", err))
+		}
+		logger.Info("未找到已保存的授权信息，需要重新授权...")
+		authorizeFn := authorize
+		if cfg.HeadlessAuth {
+			authorizeFn = func(oauth *dida.OAuth) error { return authorizeHeadless(oauth, os.Stdin, os.Stderr, false) }
+		}
+		if err := authorizeFn(oauth); err != nil {
+			return nil, withCode(exitAuthError, fmt.Errorf("授权失败: %w", err))
+		}
+		saveToken(oauth, store)
+	} else {
+		logger.Info("已加载保存的授权信息")
+	}
+
+	s := &session{
+		cfg:     cfg,
+		account: acc,
+		ns:      newNamespace(acc, cfg.NotionOwnerProperty),
+		oauth:   oauth,
+		store:   store,
+		// 创建滴答清单 API 客户端
+		dida: dida.NewClient(oauth,
+			dida.WithLogger(logger.With("service", "dida")),
+			dida.WithMetrics(syncMetrics),
+			dida.WithClock(syncClock),
+			dida.WithConcurrency(cfg.DidaConcurrency),
+			dida.WithRateLimiter(dida.NewRateLimiter(syncClock, cfg.DidaRequestInterval))),
+		tasks:   &taskIndex{},
+		running: make(chan struct{}, 1),
+	}
+
+	// 创建 Notion 客户端
+	if acc.NotionToken != "" && acc.NotionDatabaseID != "" {
+		s.notion = newNotionClient(cfg, acc)
+	}
+	return s, nil
+}
+
+// newNotionClient 创建账号的 Notion 客户端
+func newNotionClient(cfg *config.Config, acc config.Account) *notion.Client {
+	return notion.NewClient(acc.NotionToken, acc.NotionDatabaseID,
+		notion.WithLogger(logger.With("service", "notion")),
+		notion.WithMetrics(syncMetrics),
+		notion.WithClock(syncClock),
+		notion.WithArchiveDuplicates(cfg.NotionArchiveDuplicates))
+}
+
+// refreshToken 在 token 即将过期（或 force 为 true）时刷新并保存
+func (s *session) refreshToken(ctx context.Context, force bool) error {
+	var err error
+	refreshed := false
+	if force {
+		_, err = s.oauth.RefreshToken(ctx)
+		refreshed = true
+	} else {
+		refreshed, err = s.oauth.RefreshIfExpiring(ctx, tokenRefreshMargin)
+	}
+	if _, ok := err.(*dida.SinkError); ok {
+		// 新 token 已生效，只是写回失败，不影响本次同步
+		logger.Warn("警告: 刷新后的 token 未能全部保存", "error", err)
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if refreshed {
+		logger.Info("已刷新滴答清单授权信息")
+		saveToken(s.oauth, s.store)
+	}
+	return nil
+}
+
+// sync 执行一次完整的同步，过程中的统计和失败记录写入 rep。
+// since 非零时为增量同步：在 since 之后未修改且已存在于 Notion 的任务会被跳过。
+// 如果已有同步在进行，立即返回错误
+func (s *session) sync(ctx context.Context, rep *report.Run, since time.Time) error {
+	select {
+	case s.running <- struct{}{}:
+		defer func() { <-s.running }()
+	default:
+		return errors.New("上一次同步尚未结束")
+	}
+
+	didaBefore := report.APIStats(s.dida.Stats())
+	defer func() { rep.API["dida"] = rep.API["dida"].Add(report.APIStats(s.dida.Stats()).Sub(didaBefore)) }()
+
+	// 获取项目列表（用于映射项目名称）
+	logger.Info("\n正在获取滴答清单项目...", "phase", "fetch_projects")
+	endPhase := rep.StartPhase("fetch_projects")
+	projects, err := s.dida.GetProjects(ctx)
+	endPhase()
+	if err != nil {
+		return fetchError("获取项目失败", err)
+	}
+
+	// 构建项目ID -> 名称映射
+	projectMap := make(map[string]string)
+	projectMap["inbox"] = "收集箱"
+	for _, p := range projects {
+		projectMap[p.ID] = p.Name
+	}
+	rep.Counts.Projects += len(projects) + 1
+	logger.Infof("找到 %d 个项目", len(projects)+1) // +1 for inbox
+
+	// 获取所有任务
+	logger.Info("正在获取滴答清单任务...", "phase", "fetch_tasks")
+	endPhase = rep.StartPhase("fetch_tasks")
+	tasks, err := s.dida.GetTasks(ctx, projects)
+	endPhase()
+	var partial *dida.PartialError
+	if errors.As(err, &partial) {
+		if len(partial.FailedProjects()) == len(projects)+1 {
+			return fetchError("获取任务失败", err)
+		}
+		logger.Warn("部分任务获取失败", "error", err)
+		for _, f := range partial.Errors {
+			key := ""
+			if f.TaskID != "" {
+				key = s.ns.key(f.TaskID)
+			}
+			rep.AddFailure("fetch_tasks", key, "", "", f)
+		}
+	} else if err != nil {
+		return fetchError("获取任务失败", err)
+	}
+	rep.Counts.Tasks += len(tasks)
+	s.tasks.set(tasks)
+	logger.Infof("找到 %d 个任务", len(tasks))
+
+	// 获取失败的项目中有哪些任务，要从上次的记录中查找
+	scope := newFetchScope(partial, s.loadTaskProjects())
+	s.saveTaskProjects(scope.taskProjects, tasks, scope)
+
+	// 检查 Notion 配置
+	if s.notion == nil {
+		logger.Warn("\n未配置 Notion，跳过同步")
+		logger.Warn("请在 .env 文件中配置 NOTION_TOKEN 和 NOTION_DATABASE_ID")
+		return nil
+	}
+
+	notionBefore := report.APIStats(s.notion.Stats())
+	defer func() { rep.API["notion"] = rep.API["notion"].Add(report.APIStats(s.notion.Stats()).Sub(notionBefore)) }()
+
+	// 同步任务到 Notion
+	logger.Info("\n正在同步到 Notion...", "phase", "sync")
+	endPhase = rep.StartPhase("sync")
+	existing, err := s.notion.GetAllPages(ctx)
+	if err != nil {
+		endPhase()
+		return fmt.Errorf("获取 Notion 页面失败: %w", err)
+	}
+	pending := loadPendingCreates(s.cfg.StateFile, s.account.NotionDatabaseID)
+	syncResult := syncToNotion(ctx, s.notion, s.ns, tasks, existing, projectMap, since, pending, rep)
+	endPhase()
+
+	rep.Counts.Created += syncResult.Created
+	rep.Counts.Updated += syncResult.Updated
+	rep.Counts.Skipped += syncResult.Skipped
+	rep.Counts.Failed += syncResult.Failed
+
+	if shuttingDown() {
+		return errInterrupted
+	}
+
+	// 标记已完成的任务；获取失败的项目和子任务不在检查范围内，避免被误认为已删除
+	logger.Info("\n正在检查已完成的任务...", "phase", "complete")
+	endPhase = rep.StartPhase("complete")
+	completedCount, err := markCompletedTasks(ctx, s.notion, s.dida, s.ns, tasks, scope, s.completionLimit(), rep)
+	endPhase()
+	if err != nil {
+		return err
+	}
+
+	rep.Counts.Completed += completedCount
+
+	logger.Info("\n同步完成！",
+		"created", syncResult.Created, "updated", syncResult.Updated, "skipped", syncResult.Skipped,
+		"failed", syncResult.Failed, "completed", completedCount)
+	logger.Infof("  新增: %d", syncResult.Created)
+	logger.Infof("  更新: %d", syncResult.Updated)
+	logger.Infof("  跳过: %d", syncResult.Skipped)
+	logger.Infof("  失败: %d", syncResult.Failed)
+	logger.Infof("  标记完成: %d", completedCount)
+
+	if shuttingDown() {
+		return errInterrupted
+	}
+	// 部分项目或子任务没有获取到：以非零退出码结束，也不推进增量同步的起点，下次运行重新获取
+	if partial != nil && len(partial.Errors) > 0 {
+		return withCode(exitPartialFailure, fmt.Errorf("部分任务获取失败: %w", partial))
+	}
+	return nil
+}
+
+// SyncResult 同步结果
+type SyncResult struct {
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+}
+
+// syncToNotion 同步任务到 Notion，existing 为数据库中的全部页面，用于按 滴答ID 查找已有页面；
+// since 非零时跳过此后未修改且已存在的任务。
+// 创建页面前在 pending 中记录，上次创建结果未确认的任务先等待并查找已有页面。
+// 任务按父子关系排序，父任务先同步，子任务创建或更新时直接带上 父任务 关联，
+// 子任务 由 Notion 的双向关联自动维护，最后只在顺序与 ChildIDs 不一致时重写
+func syncToNotion(ctx context.Context, client *notion.Client, ns namespace, tasks []dida.Task, existing []notion.Page, projectMap map[string]string, since time.Time, pending *pendingCreates, rep *report.Run) SyncResult {
+	result := SyncResult{}
+
+	index := indexByDidaID(existing)
+	// 父任务页面 ID -> 子任务 关联的当前值，随本次写入的 父任务 关联更新
+	children := make(map[string][]string, len(existing))
+	for _, page := range existing {
+		children[page.ID] = page.Relation("子任务")
+	}
+
+	// 滴答ID -> 任务的当前页面（查询、更新或创建的响应），用于设置子任务的 父任务 关联
+	pages := make(map[string]notion.Page)
+	relationUpdated := 0
+
+	tasks = orderByParent(tasks)
+
+	// 索引中没有页面的任务要创建，先一次性记录下来，结果在阶段结束时一次写入
+	var toCreate []string
+	for _, task := range tasks {
+		key := ns.key(task.ID)
+		if len(index[key]) == 0 && (ns.prefix == "" || len(index[task.ID]) == 0) {
+			toCreate = append(toCreate, key)
+		}
+	}
+	pending.reserve(toCreate)
+	defer pending.finish()
+
+	logger.Info("同步任务...", "phase", "sync")
+	for i, task := range tasks {
+		if shuttingDown() {
+			break
+		}
+
+		// 获取项目名称
+		projectName := projectMap[task.ProjectID]
+		if projectName == "" {
+			projectName = "收集箱"
+		}
+
+		log := logger.With("task_id", task.ID, "project", projectName)
+
+		// 检查任务是否已存在
+		existingPage, err := findPage(ctx, client, index, ns.key(task.ID), pending.has(ns.key(task.ID)))
+		// 切换到多账号前同步的页面 滴答ID 没有账号前缀：任务 ID 全局唯一，属于本账号的任务直接接管该页面，
+		// 更新时写入带前缀的 滴答ID，避免重新创建
+		migrate := false
+		if err == nil && existingPage == nil && ns.prefix != "" {
+			existingPage, err = findPage(ctx, client, index, task.ID, false)
+			migrate = existingPage != nil
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("  [%d/%d] 查询失败: %s", i+1, len(tasks), task.Title), "error", err)
+			rep.AddFailure("sync", ns.key(task.ID), "", task.Title, err)
+			result.Failed++
+			continue
+		}
+		if existingPage != nil {
+			pending.remove(ns.key(task.ID))
+		}
+
+		// 父任务 关联有变化时随属性一起写入；父任务页面未知或数据库中没有 父任务 属性时不修改
+		parent, parentKnown := wantParent(task, pages)
+		setParent := parentKnown && hasParentProperty(task, existingPage, pages) && (existingPage == nil && len(parent) > 0 ||
+			existingPage != nil && relationChanged(*existingPage, "父任务", parent))
+
+		// 增量同步：任务自上次同步后未修改，无需更新
+		if existingPage != nil && !setParent && !migrate && unchangedSince(task, since) {
+			result.Skipped++
+			pages[task.ID] = *existingPage
+			continue
+		}
+
+		props := ns.properties(task, projectName)
+		if setParent {
+			props["父任务"] = notion.NewRelation(parent...)
+		}
+
+		if existingPage != nil {
+			// 更新现有页面
+			updated, err := client.UpdatePage(ctx, existingPage.ID, props)
+			if err != nil {
+				log.Error(fmt.Sprintf("  [%d/%d] 更新失败: %s", i+1, len(tasks), task.Title),
+					"page_id", existingPage.ID, "error", err)
+				rep.AddFailure("sync", ns.key(task.ID), existingPage.ID, task.Title, err)
+				result.Failed++
+			} else {
+				log.Info(fmt.Sprintf("  [%d/%d] 已更新: %s", i+1, len(tasks), task.Title), "page_id", existingPage.ID)
+				if migrate {
+					log.Info("  滴答ID 已改为带账号前缀的形式", "page_id", existingPage.ID, "key", ns.key(task.ID))
+				}
+				result.Updated++
+				pages[task.ID] = *updated
+			}
+		} else {
+			// 创建新页面
+			pending.sending(ns.key(task.ID))
+			newPage, err := client.CreatePageForDidaID(ctx, ns.key(task.ID), props)
+			if err == nil || !notion.MayHaveSucceeded(err) {
+				pending.remove(ns.key(task.ID))
+			}
+			if err != nil {
+				log.Error(fmt.Sprintf("  [%d/%d] 创建失败: %s", i+1, len(tasks), task.Title), "error", err)
+				rep.AddFailure("sync", ns.key(task.ID), "", task.Title, err)
+				result.Failed++
+			} else {
+				log.Info(fmt.Sprintf("  [%d/%d] 已创建: %s", i+1, len(tasks), task.Title), "page_id", newPage.ID)
+				result.Created++
+				pages[task.ID] = *newPage
+			}
+		}
+		if setParent {
+			if page, ok := pages[task.ID]; ok {
+				relationUpdated++
+				// Notion 从原父任务的 子任务 中移除该页面，并追加到新父任务的末尾
+				if existingPage != nil {
+					for _, id := range existingPage.Relation("父任务") {
+						children[id] = removeString(children[id], page.ID)
+					}
+				}
+				for _, id := range parent {
+					children[id] = append(children[id], page.ID)
+				}
+			}
+			// 写入失败时关联随任务一起计入 Failed
+		}
+
+		// 避免 API 限流
+		throttle(ctx)
+	}
+
+	if !shuttingDown() {
+		relationUpdated += reorderChildren(ctx, client, ns, tasks, pages, children, rep)
+	}
+
+	logger.Infof("  父子关联更新: %d", relationUpdated)
+	rep.Counts.Relations += relationUpdated
+	return result
+}
+
+// indexByDidaID 按 滴答ID 分组页面，每组最早创建的在前
+func indexByDidaID(pages []notion.Page) map[string][]notion.Page {
+	index := make(map[string][]notion.Page, len(pages))
+	for _, page := range pages {
+		if key, ok := extractDidaIDFromPage(page); ok {
+			index[key] = append(index[key], page)
+		}
+	}
+	for _, group := range index {
+		notion.SortOldestFirst(group)
+	}
+	return index
+}
+
+// findPage 在索引中查找 滴答ID 为 key 的页面。有重复页面时交给 FindPageByDidaID 处理（记录警告，按配置归档），
+// 索引中没有但上次创建结果未确认时，页面可能已经创建只是还查询不到，等待后重新查询
+func findPage(ctx context.Context, client *notion.Client, index map[string][]notion.Page, key string, pending bool) (*notion.Page, error) {
+	switch group := index[key]; {
+	case len(group) == 1:
+		return &group[0], nil
+	case len(group) > 1:
+		return client.FindPageByDidaID(ctx, key)
+	case pending:
+		return client.WaitForPageByDidaID(ctx, key)
+	}
+	return nil, nil
+}
+
+// reorderChildren 父任务 子任务 关联的顺序与 ChildIDs 不一致时重写；只调整顺序，
+// 关联的增减由子任务的 父任务 写入完成，集合不一致（如部分子任务同步失败）时不修改。
+// children 为各页面 子任务 关联的当前值，返回重写的页面数
+func reorderChildren(ctx context.Context, client *notion.Client, ns namespace, tasks []dida.Task, pages map[string]notion.Page, children map[string][]string, rep *report.Run) int {
+	// tasks 已按 orderByParent 排列，同一父任务的子任务按 ChildIDs 的顺序出现
+	want := make(map[string][]string)
+	var parentIDs []string
+	for _, task := range tasks {
+		parent, ok := pages[task.ParentID]
+		child, childOK := pages[task.ID]
+		if !ok || !childOK || task.ParentID == task.ID {
+			continue
+		}
+		if _, seen := want[parent.ID]; !seen {
+			parentIDs = append(parentIDs, task.ParentID)
+		}
+		want[parent.ID] = append(want[parent.ID], child.ID)
+	}
+
+	updated := 0
+	for _, parentID := range parentIDs {
+		if shuttingDown() {
+			break
+		}
+		page := pages[parentID]
+		if _, ok := page.Property("子任务"); !ok {
+			continue
+		}
+		current, ids := children[page.ID], want[page.ID]
+		if equalStringSlices(current, ids) || !sameIDs(current, ids) {
+			continue
+		}
+		if _, err := client.UpdatePage(ctx, page.ID, notion.Properties{"子任务": notion.NewRelation(ids...)}); err != nil {
+			logger.Error("更新子任务顺序失败", "task_id", parentID, "page_id", page.ID, "error", err)
+			rep.AddFailure("sync", ns.key(parentID), page.ID, "", err)
+			rep.Counts.RelationsFailed++
+		} else {
+			updated++
+		}
+		throttle(ctx)
+	}
+	return updated
+}
+
+// removeString 返回去掉 s 后的 ids
+func removeString(ids []string, s string) []string {
+	var out []string
+	for _, id := range ids {
+		if id != s {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// orderByParent 按父子关系排列任务：父任务排在子任务之前，同一父任务的子任务按 ChildIDs 排列，
+// 其余保持原顺序。父任务不在列表中的任务视为顶层任务；父子关系成环的任务按原顺序排在最后
+func orderByParent(tasks []dida.Task) []dida.Task {
+	byID := make(map[string]dida.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	children := make(map[string][]string)
+	for _, task := range tasks {
+		if _, ok := byID[task.ParentID]; ok && task.ParentID != task.ID {
+			children[task.ParentID] = append(children[task.ParentID], task.ID)
+		}
+	}
+	for parentID, ids := range children {
+		children[parentID] = orderByChildIDs(ids, byID[parentID].ChildIDs)
+	}
+
+	ordered := make([]dida.Task, 0, len(tasks))
+	added := make(map[string]bool, len(tasks))
+	var add func(id string)
+	add = func(id string) {
+		added[id] = true
+		ordered = append(ordered, byID[id])
+		for _, childID := range children[id] {
+			if !added[childID] {
+				add(childID)
+			}
+		}
+	}
+	for _, task := range tasks {
+		if _, ok := byID[task.ParentID]; (!ok || task.ParentID == task.ID) && !added[task.ID] {
+			add(task.ID)
+		}
+	}
+	for _, task := range tasks {
+		if !added[task.ID] {
+			logger.Warn("父子关系成环，无法设置父任务关联", "task_id", task.ID)
+			added[task.ID] = true
+			ordered = append(ordered, task)
+		}
+	}
+	return ordered
+}
+
+// orderByChildIDs 把 ids 按 childIDs 中的顺序排列，不在 childIDs 中的保持原顺序排在最后
+func orderByChildIDs(ids, childIDs []string) []string {
+	pos := make(map[string]int, len(childIDs))
+	for i, id := range childIDs {
+		pos[id] = i
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		pi, iok := pos[ids[i]]
+		pj, jok := pos[ids[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && pi < pj
+	})
+	return ids
+}
+
+// wantParent 任务应有的 父任务 关联；父任务的页面未知（同步失败或不在任务列表中）时返回 false，不修改
+func wantParent(task dida.Task, pages map[string]notion.Page) ([]string, bool) {
+	if task.ParentID == "" {
+		return nil, true
+	}
+	parent, ok := pages[task.ParentID]
+	if !ok {
+		return nil, false
+	}
+	return []string{parent.ID}, true
+}
+
+// hasParentProperty 判断数据库中是否有 父任务 属性。页面总是返回数据库的所有属性，
+// 新页面用同一数据库中的父任务页面判断；没有该属性时写入会使整个属性更新失败
+func hasParentProperty(task dida.Task, existing *notion.Page, pages map[string]notion.Page) bool {
+	if existing == nil {
+		parent, ok := pages[task.ParentID]
+		if !ok {
+			return false
+		}
+		existing = &parent
+	}
+	_, ok := existing.Property("父任务")
+	return ok
+}
+
+// relationChanged 判断页面的关联属性是否与 want 不同（不比较顺序）。
+// 关联超过 25 项时 API 只返回部分，视为已变化
+func relationChanged(page notion.Page, name string, want []string) bool {
+	prop, ok := page.Property(name)
+	if !ok {
+		return len(want) > 0
+	}
+	if prop.HasMore {
+		return true
+	}
+	return !sameIDs(page.Relation(name), want)
+}
+
+// sameIDs 判断两组 ID 是否相同（不比较顺序）
+func sameIDs(a, b []string) bool {
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return equalStringSlices(a, b)
+}
+
+// equalStringSlices 判断两个字符串切片是否相同（顺序相关）
+func equalStringSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// unchangedSince 判断任务在 since 之后是否未被修改；since 为零值或修改时间未知时视为已修改
+func unchangedSince(task dida.Task, since time.Time) bool {
+	if since.IsZero() || task.ModifiedTime.IsZero() {
+		return false
+	}
+	return task.ModifiedTime.Before(since)
+}
+
+// extractDidaIDFromPage 从 Notion 页面中提取 TickTick ID
+func extractDidaIDFromPage(page notion.Page) (string, bool) {
+	id, _ := page.Text("滴答ID")
+	return id, id != ""
+}
+
+// extractStatusFromPage 从 Notion 页面中提取状态
+func extractStatusFromPage(page notion.Page) (string, bool) {
+	return page.Status("状态")
+}
+
+// minGuardedCompletions 标记完成的页面不超过该数量时不做比例检查，避免小数据库中删除少量任务就触发
+const minGuardedCompletions = 5
+
+// fetchScope 本次从滴答清单获取成功的范围。范围外的页面对应的任务可能只是没有获取到，
+// 不能据此判断任务已被删除
+type fetchScope struct {
+	failedProjects map[string]bool   // 获取失败的项目 ID
+	failedTasks    map[string]bool   // 获取失败的子任务 ID
+	taskProjects   map[string]string // 上次记录的任务所在项目（任务 ID -> 项目 ID）
+}
+
+// newFetchScope 根据部分获取失败的错误构建获取范围，partial 为 nil 时范围包括所有页面。
+// taskProjects 为上次同步时记录的任务所在项目，用于判断本次缺失的任务属于哪个项目
+func newFetchScope(partial *dida.PartialError, taskProjects map[string]string) fetchScope {
+	scope := fetchScope{failedProjects: make(map[string]bool), failedTasks: make(map[string]bool), taskProjects: taskProjects}
+	if partial == nil {
+		return scope
+	}
+	for _, id := range partial.FailedProjects() {
+		scope.failedProjects[id] = true
+	}
+	for _, id := range partial.FailedTasks() {
+		scope.failedTasks[id] = true
+	}
+	return scope
+}
+
+// covers 判断任务是否在获取范围内。有项目获取失败时，按记录的任务所在项目判断（页面的 项目 属性可能被改名或手动修改），
+// 没有记录的任务无法确定所在项目，视为范围外
+func (s fetchScope) covers(taskID string) bool {
+	if s.failedTasks[taskID] {
+		return false
+	}
+	if len(s.failedProjects) == 0 {
+		return true
+	}
+	projectID, ok := s.taskProjects[taskID]
+	return ok && !s.failedProjects[projectID]
+}
+
+// completionLimit 本次运行允许因滴答清单中已不存在而标记完成的页面比例，0 表示不限制
+func (s *session) completionLimit() float64 {
+	if s.cfg.Force {
+		return 0
+	}
+	return s.cfg.MaxCompleteFraction
+}
+
+// markCompletedTasks 标记已完成的任务
+// 1. 获取 Notion 数据库中的所有页面
+// 2. 与 TickTick 任务进行比较
+// 3. 如果 Notion 显示任务已完成但 TickTick 中未完成，则更新 TickTick
+// 4. 如果任务在 Notion 中存在但在 TickTick 中不存在（已被删除或完成），则在 Notion 中标记为完成；
+// 只检查 scope 范围内的页面。将要标记的页面超过账号页面的 maxFraction 时（maxFraction 为 0 不检查），
+// 不做任何修改并返回错误，通常说明滴答清单返回的数据不完整
+func markCompletedTasks(ctx context.Context, notionClient *notion.Client, didaClient *dida.Client, ns namespace, tickTickTasks []dida.Task, scope fetchScope, maxFraction float64, rep *report.Run) (int, error) {
+	// 获取 Notion 数据库中的所有页面
+	notionPages, err := notionClient.GetAllPages(ctx)
+	if err != nil {
+		return 0, withCode(exitPartialFailure, fmt.Errorf("获取 Notion 页面失败，未检查已完成的任务: %w", err))
+	}
+
+	// 创建 TickTick 任务 ID 映射
+	tickTickTaskMap := make(map[string]dida.Task)
+	for _, task := range tickTickTasks {
+		tickTickTaskMap[task.ID] = task
+	}
+
+	// 创建 Notion 中任务的映射，只包含当前账号的页面
+	notionTaskMap := make(map[string]notion.Page)
+	for _, page := range notionPages {
+		if didaID, exists := extractDidaIDFromPage(page); exists {
+			if taskID, ok := ns.taskID(didaID); ok {
+				notionTaskMap[taskID] = page
+			}
+		}
+	}
+
+	// 安全检查：统计将要因滴答清单中不存在而标记完成的页面
+	missing := 0
+	for notionTaskID, notionPage := range notionTaskMap {
+		if _, ok := tickTickTaskMap[notionTaskID]; ok || !scope.covers(notionTaskID) {
+			continue
+		}
+		if status, ok := extractStatusFromPage(notionPage); ok && status != "完成" {
+			missing++
+		}
+	}
+	if maxFraction > 0 && missing > minGuardedCompletions && float64(missing) > maxFraction*float64(len(notionTaskMap)) {
+		err := fmt.Errorf("%d/%d 个页面对应的任务在滴答清单中不存在，超过 SYNC_MAX_COMPLETE_FRACTION=%g，未标记完成；确认无误后使用 -force 运行",
+			missing, len(notionTaskMap), maxFraction)
+		logger.Error(err.Error(), "phase", "complete", "missing", missing, "pages", len(notionTaskMap))
+		return 0, withCode(exitSafetyAbort, err)
+	}
+
+	completedCount := 0
+
+	// 检查 Notion 状态是否需要同步
+	for notionTaskID, notionPage := range notionTaskMap {
+		if shuttingDown() {
+			break
+		}
+
+		notionStatus, statusExists := extractStatusFromPage(notionPage)
+		if !statusExists {
+			continue
+		}
+
+		notionCompleted := notionStatus == "完成"
+
+		tickTickTask, existsInTickTick := tickTickTaskMap[notionTaskID]
+		if !existsInTickTick && !scope.covers(notionTaskID) {
+			// 任务所在的项目本次获取失败，无法判断是否已删除
+			continue
+		}
+		if !existsInTickTick {
+			// 任务在 Notion 中存在但在 TickTick 中不存在
+			// 说明该任务已经在滴答清单中被删除或完成
+			// 在 Notion 中标记该任务为完成
+			if !notionCompleted {
+				props := notion.Properties{"状态": notion.NewStatus("完成")}
+				_, err := notionClient.UpdatePage(ctx, notionPage.ID, props)
+				if err != nil {
+					logger.Error("在 Notion 中标记完成失败",
+						"task_id", notionTaskID, "page_id", notionPage.ID, "error", err)
+					rep.AddFailure("complete", ns.key(notionTaskID), notionPage.ID, "", err)
+					rep.Counts.CompleteFailed++
+				} else {
+					logger.Info("已在 Notion 中标记完成（滴答清单中已不存在）", "task_id", notionTaskID, "page_id", notionPage.ID)
+					completedCount++
+				}
+				throttle(ctx)
+			}
+			continue
+		}
+
+		// 同步 Notion 完成状态到 TickTick
+		tickTickCompleted := tickTickTask.Status == 2
+		if notionCompleted && !tickTickCompleted {
+			err := didaClient.UpdateTaskStatus(ctx, tickTickTask.ProjectID, tickTickTask.ID, 2)
+			if err != nil {
+				logger.Error(fmt.Sprintf("更新 TickTick 任务状态失败: %s", tickTickTask.Title),
+					"task_id", tickTickTask.ID, "page_id", notionPage.ID, "error", err)
+				rep.AddFailure("complete", ns.key(tickTickTask.ID), notionPage.ID, tickTickTask.Title, err)
+				rep.Counts.CompleteFailed++
+			} else {
+				logger.Info(fmt.Sprintf("已同步完成状态到 TickTick: %s", tickTickTask.Title),
+					"task_id", tickTickTask.ID, "page_id", notionPage.ID)
+				completedCount++
+			}
+		} else if !notionCompleted && tickTickCompleted {
+			// 如果 Notion 中是未完成状态而 TickTick 中已完成，则根据策略决定是否更新
+			// 根据同步策略，可能需要将 TickTick 任务状态改回未完成
+			// 这取决于同步方向策略
+			syncMetrics.IncConflicts()
+			logger.Warn(fmt.Sprintf("Notion 与 TickTick 状态不一致: %s", tickTickTask.Title),
+				"task_id", tickTickTask.ID, "page_id", notionPage.ID)
+		}
+	}
+
+	return completedCount, nil
+}
+
+// throttle 在连续的 Notion 写操作之间等待，避免触发限流
+func throttle(ctx context.Context) {
+	if syncClock.Sleep(ctx, rateLimitDelay) == nil {
+		syncMetrics.ObserveRateLimitWait("notion", rateLimitDelay)
+	}
+}
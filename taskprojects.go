@@ -0,0 +1,63 @@
+package main
+
+import (
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/state"
+)
+
+// loadTaskProjects 返回账号上次记录的任务所在项目（任务 ID -> 项目 ID）。
+// 同一进程中使用内存中的记录，否则从状态文件加载；没有记录时返回空
+func (s *session) loadTaskProjects() map[string]string {
+	if s.taskProjects != nil {
+		return s.taskProjects
+	}
+	projects := make(map[string]string)
+	if s.cfg.StateFile == "" {
+		return projects
+	}
+	st, err := state.Load(s.cfg.StateFile)
+	if err != nil {
+		logger.Warn("警告: 加载状态文件失败，无法确定任务所在项目", "file", s.cfg.StateFile, "error", err)
+		return projects
+	}
+	for key, projectID := range st.TaskProjects[s.account.NotionDatabaseID] {
+		if id, ok := s.ns.taskID(key); ok {
+			projects[id] = projectID
+		}
+	}
+	return projects
+}
+
+// saveTaskProjects 按本次获取的任务更新记录：获取成功的部分以本次结果为准，
+// 获取失败的项目和子任务保留上次的记录，下次仍能判断其页面不在获取范围内
+func (s *session) saveTaskProjects(old map[string]string, tasks []dida.Task, scope fetchScope) {
+	projects := make(map[string]string, len(tasks))
+	for id, projectID := range old {
+		if scope.failedProjects[projectID] || scope.failedTasks[id] {
+			projects[id] = projectID
+		}
+	}
+	for _, task := range tasks {
+		projects[task.ID] = task.ProjectID
+	}
+	s.taskProjects = projects
+
+	if s.cfg.StateFile == "" || s.account.NotionDatabaseID == "" {
+		return
+	}
+	err := state.Update(s.cfg.StateFile, func(st *state.State) {
+		saved := st.TaskProjectsOf(s.account.NotionDatabaseID)
+		// 同一数据库中其他账号的记录保持不变
+		for key := range saved {
+			if _, ok := s.ns.taskID(key); ok {
+				delete(saved, key)
+			}
+		}
+		for id, projectID := range projects {
+			saved[s.ns.key(id)] = projectID
+		}
+	})
+	if err != nil {
+		logger.Warn("警告: 保存状态文件失败", "file", s.cfg.StateFile, "error", err)
+	}
+}
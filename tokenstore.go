@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"dida-to-notion-sync/config"
+	"dida-to-notion-sync/dida"
+	"dida-to-notion-sync/ghsecret"
+)
+
+// newTokenStore 按 DIDA_TOKEN_STORE 创建 token 存储
+func newTokenStore(acc config.Account) (dida.TokenStore, error) {
+	switch acc.TokenStore {
+	case "env":
+		return dida.EnvTokenStore{Var: acc.TokenEnv}, nil
+	case "encrypted":
+		if acc.TokenPassphrase == "" {
+			return nil, withCode(exitConfigError, fmt.Errorf("使用加密 token 文件时请配置 DIDA_TOKEN_PASSPHRASE"))
+		}
+		return dida.EncryptedFileTokenStore{Path: acc.TokenFile, Passphrase: acc.TokenPassphrase}, nil
+	case "command":
+		if acc.TokenCommand == "" {
+			return nil, withCode(exitConfigError, fmt.Errorf("使用外部命令存储 token 时请配置 DIDA_TOKEN_COMMAND"))
+		}
+		return dida.CommandTokenStore{Command: acc.TokenCommand}, nil
+	case "keyring":
+		return dida.KeyringTokenStore{Service: acc.TokenKeyringService, Account: acc.TokenKeyringAccount}, nil
+	default:
+		return dida.FileTokenStore{Path: acc.TokenFile}, nil
+	}
+}
+
+// saveToken 保存当前 token，只读存储（如环境变量）跳过保存
+func saveToken(oauth *dida.OAuth, store dida.TokenStore) {
+	err := oauth.SaveToken(store)
+	switch {
+	case err == dida.ErrReadOnlyStore:
+		logger.Info("token 存储为只读，新 token 未保存")
+	case err != nil:
+		logger.Warn("警告: 保存 token 失败", "error", err)
+	default:
+		logger.Info("Token 已保存")
+	}
+}
+
+// githubSecretSink 将刷新后的 token 写回 GitHub Actions 仓库 secret，
+// 使 CI 下次运行时读取到的是最新 token
+type githubSecretSink struct {
+	client *ghsecret.Client
+	name   string
+}
+
+// newTokenSinks 按配置创建 token sink
+func newTokenSinks(cfg *config.Config, acc config.Account) []dida.TokenSink {
+	var sinks []dida.TokenSink
+	if acc.GitHubSecretName != "" {
+		sinks = append(sinks, githubSecretSink{
+			client: ghsecret.NewClient(cfg.GitHubAPIURL, cfg.GitHubSecretToken, cfg.GitHubRepository),
+			name:   acc.GitHubSecretName,
+		})
+	}
+	return sinks
+}
+
+func (s githubSecretSink) Put(ctx context.Context, token *dida.TokenResponse) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := s.client.PutSecret(ctx, s.name, string(data)); err != nil {
+		return fmt.Errorf("更新 GitHub secret %s 失败: %w", s.name, err)
+	}
+	logger.Info(fmt.Sprintf("已将新 token 写回 GitHub secret %s", s.name))
+	return nil
+}